@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/nikolovlazar/tracing-demos/background-job-errors/backend/publisher"
 	"github.com/nikolovlazar/tracing-demos/background-job-errors/backend/shared"
+	"github.com/nikolovlazar/tracing-demos/background-job-errors/backend/telemetry"
 )
 
 type GenerateReportResponse struct {
@@ -24,14 +26,16 @@ type GenerateReportRequest struct {
 }
 
 func main() {
-	// Initialize Sentry
-	err := sentry.Init(sentry.ClientOptions{
-		Dsn: "https://1fca7e4659d55182835b0c6983ef4d4a@o4506044970565632.ingest.us.sentry.io/4509039649292288",
-		EnableTracing: true,
-		TracesSampleRate: 1.0,
-	})
+	// Initialize Sentry from SENTRY_* env vars or -sentry-* flags
+	telemetryOptions, err := telemetry.OptionsFromEnv("background-job-errors-server")
 	if err != nil {
-		log.Fatalf("sentry.Init: %s", err)
+		log.Fatal(err)
+	}
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := telemetry.Init(telemetryOptions); err != nil {
+		log.Fatal(err)
 	}
 	defer sentry.Flush(2 * time.Second)
 
@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Options configures Sentry for the server and the worker
+type Options struct {
+	// DSN is where events are sent. Without one Sentry runs with a no-op
+	// transport, so the demo works offline.
+	DSN              string
+	Environment      string
+	Release          string
+	TracesSampleRate float64
+	// IgnorePaths are URL path prefixes whose transactions are never sent
+	IgnorePaths []string
+	Debug       bool
+}
+
+// OptionsFromEnv reads SENTRY_DSN, SENTRY_ENVIRONMENT, SENTRY_RELEASE,
+// SENTRY_TRACES_SAMPLE_RATE, SENTRY_IGNORE_PATHS and SENTRY_DEBUG. The
+// release defaults to <service>@<VCS revision>.
+func OptionsFromEnv(service string) (Options, error) {
+	options := Options{
+		DSN:              os.Getenv("SENTRY_DSN"),
+		Environment:      getEnv("SENTRY_ENVIRONMENT", "development"),
+		Release:          getEnv("SENTRY_RELEASE", service+"@"+version()),
+		TracesSampleRate: 1.0,
+		IgnorePaths:      splitList(getEnv("SENTRY_IGNORE_PATHS", "/health")),
+	}
+
+	if value := os.Getenv("SENTRY_TRACES_SAMPLE_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return Options{}, fmt.Errorf("invalid SENTRY_TRACES_SAMPLE_RATE %q, expected a value between 0 and 1", value)
+		}
+		options.TracesSampleRate = rate
+	}
+
+	if value := os.Getenv("SENTRY_DEBUG"); value != "" {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("invalid SENTRY_DEBUG: %w", err)
+		}
+		options.Debug = debug
+	}
+
+	return options, nil
+}
+
+// RegisterFlags lets command-line flags override the env values
+func (o *Options) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.DSN, "sentry-dsn", o.DSN, "Sentry DSN; empty disables sending events")
+	flags.StringVar(&o.Environment, "sentry-environment", o.Environment, "Sentry environment")
+	flags.StringVar(&o.Release, "sentry-release", o.Release, "Sentry release")
+	flags.Float64Var(&o.TracesSampleRate, "sentry-traces-sample-rate", o.TracesSampleRate, "share of transactions sent to Sentry, from 0 to 1")
+	flags.Func("sentry-ignore-paths", "comma separated URL path prefixes never traced", func(value string) error {
+		o.IgnorePaths = splitList(value)
+		return nil
+	})
+	flags.BoolVar(&o.Debug, "sentry-debug", o.Debug, "log Sentry SDK debug output")
+}
+
+// Init sets up the Sentry SDK
+func Init(options Options) error {
+	if options.DSN == "" {
+		log.Println("No SENTRY_DSN set, events and traces won't be sent to Sentry")
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              options.DSN,
+		Environment:      options.Environment,
+		Release:          options.Release,
+		Debug:            options.Debug,
+		AttachStacktrace: true,
+		EnableTracing:    true,
+		TracesSampleRate: options.TracesSampleRate,
+		TracesSampler: sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
+			name := ctx.Span.Name
+			if _, path, ok := strings.Cut(name, " "); ok {
+				name = path
+			}
+			for _, prefix := range options.IgnorePaths {
+				if strings.HasPrefix(name, prefix) {
+					return 0.0
+				}
+			}
+			return options.TracesSampleRate
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("sentry.Init: %w", err)
+	}
+
+	return nil
+}
+
+// version is the VCS revision the binary was built from, if Go recorded it
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/nikolovlazar/tracing-demos/background-job-errors/backend/shared"
+	"github.com/nikolovlazar/tracing-demos/background-job-errors/backend/telemetry"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -52,15 +54,16 @@ func processHRReport(ctx context.Context, data *employeeData) {
 }
 
 func main() {
-	// Initialize Sentry
-	err := sentry.Init(sentry.ClientOptions{
-		Dsn:              "https://1fca7e4659d55182835b0c6983ef4d4a@o4506044970565632.ingest.us.sentry.io/4509039649292288", // Replace with your actual DSN
-		EnableTracing:    true,
-		TracesSampleRate: 1.0,
-		AttachStacktrace: true,
-	})
+	// Initialize Sentry from SENTRY_* env vars or -sentry-* flags
+	telemetryOptions, err := telemetry.OptionsFromEnv("background-job-errors-worker")
 	if err != nil {
-		log.Fatalf("sentry.Init: %s", err)
+		log.Fatal(err)
+	}
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := telemetry.Init(telemetryOptions); err != nil {
+		log.Fatal(err)
 	}
 	defer sentry.Flush(2 * time.Second)
 
@@ -2,68 +2,196 @@ package main
 
 import (
 	"context"
+	"delivery/internal/platform/buildinfo"
+	"delivery/internal/platform/logging"
+	"delivery/internal/platform/metrics"
+	"delivery/internal/platform/tracing"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"delivery/internal/blobstore"
+	"delivery/internal/config"
+	"delivery/internal/geo"
 	"delivery/internal/handlers"
 	"delivery/internal/messaging"
+	"delivery/internal/platform/admin"
 	"delivery/internal/platform/consul"
+	"delivery/internal/platform/dynconfig"
+	"delivery/internal/platform/faults"
+	"delivery/internal/platform/health"
+	"delivery/internal/platform/lifecycle"
+	"delivery/internal/platform/telemetry"
+	"delivery/internal/repository"
 
-	"github.com/getsentry/sentry-go"
 	sentryhttp "github.com/getsentry/sentry-go/http"
 )
 
 func main() {
-	if err := sentry.Init(sentry.ClientOptions{
-		Dsn:              "https://b4ddadd3686eb05f7ba1c2f76a7a7351@o4506044970565632.ingest.us.sentry.io/4509198467989504",
-		TracesSampleRate: 1.0,
-		AttachStacktrace: true,
-		EnableTracing:    true,
-		TracesSampler: sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
-			if ctx.Span.Name == "GET /health" {
-				return 0.0
-			}
-			return 1.0
-		}),
-	}); err != nil {
-		log.Fatalf("Sentry initialization failed: %s", err)
+	if err := logging.Setup("delivery"); err != nil {
+		log.Fatal(err)
+	}
+	if err := faults.LoadFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	configSource, err := dynconfig.NewSourceFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), 5*time.Second)
+	settings, err := dynconfig.Load[config.Config](loadCtx, configSource, "delivery")
+	cancelLoad()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	telemetryOptions, err := telemetry.OptionsFromEnv("delivery")
+	if err != nil {
+		log.Fatal(err)
 	}
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// The sample rate can be changed in Consul KV without a restart
+	telemetryOptions.SampleRate = func() float64 {
+		return settings.Current().TracesSampleRate
+	}
+	if err := telemetry.Init(telemetryOptions); err != nil {
+		log.Fatal(err)
+	}
+
+	tracingOptions, err := tracing.OptionsFromEnv("delivery", buildinfo.Read().Version, telemetryOptions.Environment)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), tracingOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracing.OnFinish(metrics.ObserveSpan)
 
 	sentryHandler := sentryhttp.New(sentryhttp.Options{
 		Repanic: true,
 	})
 
+	deliveryRepo, err := repository.NewDeliveryRepository()
+	if err != nil {
+		log.Fatal("❌ Failed to create delivery repository: ", err)
+	}
+
 	rabbitmq, err := messaging.NewRabbitMQClient()
 	if err != nil {
 		log.Fatal("❌ Failed to create RabbitMQ client: ", err)
 	}
-	defer rabbitmq.Close()
 
-	handler := handlers.NewDeliveryHandler(rabbitmq)
+	blobs, err := blobstore.NewStoreFromEnv()
+	if err != nil {
+		log.Fatal("❌ Failed to create blob store: ", err)
+	}
+
+	pickup, err := geo.PickupFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	http.HandleFunc("/health", sentryHandler.HandleFunc(handler.HandleHealthCheck))
+	geocoder, err := geo.NewGeocoderFromEnv(pickup)
+	if err != nil {
+		log.Fatal("❌ Failed to create geocoder: ", err)
+	}
 
-	go rabbitmq.ConsumeEvents(
-		context.Background(),
-		handler.HandleReadyForDelivery,
-	)
+	router, err := geo.NewRouterFromEnv()
+	if err != nil {
+		log.Fatal("❌ Failed to create router: ", err)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8082"
 	}
 
+	server := &http.Server{Addr: ":" + port}
+
+	lc := lifecycle.New(server)
+	// Registered first so it runs last, after everything that records spans.
+	lc.OnClose(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("❌ OpenTelemetry: Failed to flush spans: %v", err)
+		}
+	})
+	lc.OnClose(rabbitmq.Close)
+
+	handler := handlers.NewDeliveryHandler(rabbitmq, deliveryRepo, blobs, geocoder, router, pickup, settings, lc.Spawn)
+	server.RegisterOnShutdown(handler.CloseStreams)
+
+	if err := handler.ResumeDeliveries(context.Background()); err != nil {
+		log.Fatal("❌ Failed to resume unfinished deliveries: ", err)
+	}
+
+	metrics.ConnectionState(rabbitmq.Connected)
+
+	checks := health.NewChecker()
+	checks.Add("postgres", deliveryRepo.Ping)
+	checks.Add("rabbitmq", rabbitmq.Ping)
+	checks.Add("consumer", rabbitmq.ConsumerHealth)
+
+	http.HandleFunc("GET /health/live", sentryHandler.HandleFunc(checks.HandleLive))
+	http.HandleFunc("GET /health/ready", sentryHandler.HandleFunc(checks.HandleReady))
+	// Kept for anything still probing the old endpoint.
+	http.HandleFunc("GET /health", sentryHandler.HandleFunc(checks.HandleReady))
+	http.Handle("GET /metrics", metrics.Handler())
+
+	adminRouter := admin.New(os.Getenv("ADMIN_TOKEN"))
+	adminRouter.Section("config", func(ctx context.Context) interface{} {
+		return settings.Values()
+	})
+	adminRouter.Consumer(rabbitmq)
+	adminRouter.Section("deliveries", func(ctx context.Context) interface{} {
+		return handler.Active()
+	})
+	faultsHandler := faults.Handler()
+	adminRouter.Handle("/admin/faults", faultsHandler)
+	adminRouter.Handle("/admin/faults/", faultsHandler)
+	http.Handle("/admin", adminRouter)
+	http.Handle("/admin/", adminRouter)
+
+	http.HandleFunc("GET /deliveries/{orderId}", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleGetDelivery))))
+	http.HandleFunc("GET /deliveries/{orderId}/stream", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleStreamDelivery))))
+	http.HandleFunc("POST /deliveries/{orderId}/locations", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleRecordLocation))))
+	http.HandleFunc("POST /deliveries/{orderId}/fail", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleFailDelivery))))
+	http.HandleFunc("POST /deliveries/{orderId}/complete", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleCompleteDelivery))))
+	http.HandleFunc("GET /deliveries/{orderId}/proof", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleGetProof))))
+
+	consulConfig, err := consul.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lc.Go("Config watcher", settings.Watch)
+
+	lc.Go("AMQP consumer", func(ctx context.Context) error {
+		return rabbitmq.ConsumeEvents(
+			ctx,
+			handler.HandleReadyForDelivery,
+		)
+	})
+
 	go func() {
 		time.Sleep(time.Second * 3)
-		if err := consul.RegisterService(); err != nil {
+		registration, err := consul.RegisterService(consulConfig)
+		if err != nil {
 			log.Fatal("❌ Failed to register with Consul: ", err)
 		}
+		registration.ReportHealth(checks.Ready)
+		lc.SetRegistration(registration.Deregister)
 	}()
 
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := lc.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
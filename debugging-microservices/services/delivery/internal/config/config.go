@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config holds the delivery service settings that can change at runtime.
+// They are read from Consul KV under config/delivery/, falling back to env
+// and then to the defaults below.
+type Config struct {
+	// TimeScale compresses routed travel times for simulated deliveries and
+	// their ETAs, so a demo doesn't take as long as a real drive. 1 is real
+	// time.
+	TimeScale float64 `key:"time_scale" env:"DELIVERY_TIME_SCALE" default:"0.05"`
+	// AssignmentRetryInterval is how often a queued delivery looks for a
+	// free driver again, on top of being woken up when a local delivery
+	// frees one.
+	AssignmentRetryInterval time.Duration `key:"assignment_retry_interval" env:"DELIVERY_ASSIGNMENT_RETRY_INTERVAL" default:"5s"`
+	// FailureRate is the chance of a simulated delivery failing.
+	FailureRate float64 `key:"failure_rate" env:"DELIVERY_FAILURE_RATE" default:"0"`
+	// MaxAttempts is how many times a delivery is attempted before it's
+	// returned to the kitchen.
+	MaxAttempts int `key:"max_attempts" env:"DELIVERY_MAX_ATTEMPTS" default:"2"`
+	// AutoComplete finishes deliveries on a timer. When it's off, deliveries
+	// stay on the road until the driver completes or fails them over HTTP.
+	AutoComplete     bool    `key:"auto_complete" env:"DELIVERY_AUTO_COMPLETE" default:"true"`
+	TracesSampleRate float64 `key:"traces_sample_rate" env:"SENTRY_TRACES_SAMPLE_RATE" default:"1.0"`
+}
+
+func (c *Config) Validate() error {
+	if c.TimeScale <= 0 {
+		return fmt.Errorf("time_scale must be positive, got %v", c.TimeScale)
+	}
+	if c.AssignmentRetryInterval <= 0 {
+		return fmt.Errorf("assignment_retry_interval must be positive, got %s", c.AssignmentRetryInterval)
+	}
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return fmt.Errorf("failure_rate must be between 0 and 1, got %v", c.FailureRate)
+	}
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be at least 1, got %d", c.MaxAttempts)
+	}
+	if c.TracesSampleRate < 0 || c.TracesSampleRate > 1 {
+		return fmt.Errorf("traces_sample_rate must be between 0 and 1, got %v", c.TracesSampleRate)
+	}
+	return nil
+}
@@ -9,7 +9,7 @@ package events
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
-	_ "google.golang.org/protobuf/types/known/timestamppb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -22,6 +22,58 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type DeliveryFailureReason int32
+
+const (
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_UNSPECIFIED          DeliveryFailureReason = 0
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE DeliveryFailureReason = 1
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_ADDRESS_INVALID      DeliveryFailureReason = 2
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_DRIVER_INCIDENT      DeliveryFailureReason = 3
+)
+
+// Enum value maps for DeliveryFailureReason.
+var (
+	DeliveryFailureReason_name = map[int32]string{
+		0: "DELIVERY_FAILURE_REASON_UNSPECIFIED",
+		1: "DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE",
+		2: "DELIVERY_FAILURE_REASON_ADDRESS_INVALID",
+		3: "DELIVERY_FAILURE_REASON_DRIVER_INCIDENT",
+	}
+	DeliveryFailureReason_value = map[string]int32{
+		"DELIVERY_FAILURE_REASON_UNSPECIFIED":          0,
+		"DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE": 1,
+		"DELIVERY_FAILURE_REASON_ADDRESS_INVALID":      2,
+		"DELIVERY_FAILURE_REASON_DRIVER_INCIDENT":      3,
+	}
+)
+
+func (x DeliveryFailureReason) Enum() *DeliveryFailureReason {
+	p := new(DeliveryFailureReason)
+	*p = x
+	return p
+}
+
+func (x DeliveryFailureReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DeliveryFailureReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_events_delivery_proto_enumTypes[0].Descriptor()
+}
+
+func (DeliveryFailureReason) Type() protoreflect.EnumType {
+	return &file_proto_events_delivery_proto_enumTypes[0]
+}
+
+func (x DeliveryFailureReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DeliveryFailureReason.Descriptor instead.
+func (DeliveryFailureReason) EnumDescriptor() ([]byte, []int) {
+	return file_proto_events_delivery_proto_rawDescGZIP(), []int{0}
+}
+
 type OrderItem struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -143,10 +195,12 @@ func (x *OrderReadyForDeliveryEvent) GetCustomerId() string {
 }
 
 type DeliveryStartedEvent struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	OrderId            int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	EstimatedArrivalAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=estimated_arrival_at,json=estimatedArrivalAt,proto3" json:"estimated_arrival_at,omitempty"`
+	DriverId           string                 `protobuf:"bytes,4,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *DeliveryStartedEvent) Reset() {
@@ -186,16 +240,123 @@ func (x *DeliveryStartedEvent) GetOrderId() int32 {
 	return 0
 }
 
+func (x *DeliveryStartedEvent) GetEstimatedArrivalAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EstimatedArrivalAt
+	}
+	return nil
+}
+
+func (x *DeliveryStartedEvent) GetDriverId() string {
+	if x != nil {
+		return x.DriverId
+	}
+	return ""
+}
+
+type ProofOfDelivery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RecipientName string                 `protobuf:"bytes,1,opt,name=recipient_name,json=recipientName,proto3" json:"recipient_name,omitempty"`
+	Kind          string                 `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	Url           string                 `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	ContentType   string                 `protobuf:"bytes,4,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Latitude      float64                `protobuf:"fixed64,5,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,6,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	CapturedAt    *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=captured_at,json=capturedAt,proto3" json:"captured_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProofOfDelivery) Reset() {
+	*x = ProofOfDelivery{}
+	mi := &file_proto_events_delivery_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProofOfDelivery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProofOfDelivery) ProtoMessage() {}
+
+func (x *ProofOfDelivery) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_events_delivery_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProofOfDelivery.ProtoReflect.Descriptor instead.
+func (*ProofOfDelivery) Descriptor() ([]byte, []int) {
+	return file_proto_events_delivery_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ProofOfDelivery) GetRecipientName() string {
+	if x != nil {
+		return x.RecipientName
+	}
+	return ""
+}
+
+func (x *ProofOfDelivery) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+func (x *ProofOfDelivery) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *ProofOfDelivery) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ProofOfDelivery) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *ProofOfDelivery) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *ProofOfDelivery) GetCapturedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CapturedAt
+	}
+	return nil
+}
+
 type DeliveryCompletedEvent struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Proof         *ProofOfDelivery       `protobuf:"bytes,3,opt,name=proof,proto3" json:"proof,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *DeliveryCompletedEvent) Reset() {
 	*x = DeliveryCompletedEvent{}
-	mi := &file_proto_events_delivery_proto_msgTypes[3]
+	mi := &file_proto_events_delivery_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -207,7 +368,7 @@ func (x *DeliveryCompletedEvent) String() string {
 func (*DeliveryCompletedEvent) ProtoMessage() {}
 
 func (x *DeliveryCompletedEvent) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_events_delivery_proto_msgTypes[3]
+	mi := &file_proto_events_delivery_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -220,7 +381,7 @@ func (x *DeliveryCompletedEvent) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeliveryCompletedEvent.ProtoReflect.Descriptor instead.
 func (*DeliveryCompletedEvent) Descriptor() ([]byte, []int) {
-	return file_proto_events_delivery_proto_rawDescGZIP(), []int{3}
+	return file_proto_events_delivery_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *DeliveryCompletedEvent) GetOrderId() int32 {
@@ -230,6 +391,97 @@ func (x *DeliveryCompletedEvent) GetOrderId() int32 {
 	return 0
 }
 
+func (x *DeliveryCompletedEvent) GetProof() *ProofOfDelivery {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+type DeliveryFailedEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Reason        DeliveryFailureReason  `protobuf:"varint,3,opt,name=reason,proto3,enum=events.DeliveryFailureReason" json:"reason,omitempty"`
+	Details       string                 `protobuf:"bytes,4,opt,name=details,proto3" json:"details,omitempty"`
+	Attempt       int32                  `protobuf:"varint,5,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	WillReattempt bool                   `protobuf:"varint,6,opt,name=will_reattempt,json=willReattempt,proto3" json:"will_reattempt,omitempty"`
+	DriverId      string                 `protobuf:"bytes,7,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeliveryFailedEvent) Reset() {
+	*x = DeliveryFailedEvent{}
+	mi := &file_proto_events_delivery_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeliveryFailedEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeliveryFailedEvent) ProtoMessage() {}
+
+func (x *DeliveryFailedEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_events_delivery_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeliveryFailedEvent.ProtoReflect.Descriptor instead.
+func (*DeliveryFailedEvent) Descriptor() ([]byte, []int) {
+	return file_proto_events_delivery_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeliveryFailedEvent) GetOrderId() int32 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *DeliveryFailedEvent) GetReason() DeliveryFailureReason {
+	if x != nil {
+		return x.Reason
+	}
+	return DeliveryFailureReason_DELIVERY_FAILURE_REASON_UNSPECIFIED
+}
+
+func (x *DeliveryFailedEvent) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *DeliveryFailedEvent) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *DeliveryFailedEvent) GetWillReattempt() bool {
+	if x != nil {
+		return x.WillReattempt
+	}
+	return false
+}
+
+func (x *DeliveryFailedEvent) GetDriverId() string {
+	if x != nil {
+		return x.DriverId
+	}
+	return ""
+}
+
 var File_proto_events_delivery_proto protoreflect.FileDescriptor
 
 const file_proto_events_delivery_proto_rawDesc = "" +
@@ -243,11 +495,35 @@ const file_proto_events_delivery_proto_rawDesc = "" +
 	"\x05items\x18\x03 \x03(\v2\x11.events.OrderItemR\x05items\x12)\n" +
 	"\x10delivery_address\x18\x04 \x01(\tR\x0fdeliveryAddress\x12\x1f\n" +
 	"\vcustomer_id\x18\x05 \x01(\tR\n" +
-	"customerId\"1\n" +
+	"customerId\"\x9c\x01\n" +
 	"\x14DeliveryStartedEvent\x12\x19\n" +
-	"\border_id\x18\x02 \x01(\x05R\aorderId\"3\n" +
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x12L\n" +
+	"\x14estimated_arrival_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x12estimatedArrivalAt\x12\x1b\n" +
+	"\tdriver_id\x18\x04 \x01(\tR\bdriverId\"\xf8\x01\n" +
+	"\x0fProofOfDelivery\x12%\n" +
+	"\x0erecipient_name\x18\x01 \x01(\tR\rrecipientName\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\x12\x10\n" +
+	"\x03url\x18\x03 \x01(\tR\x03url\x12!\n" +
+	"\fcontent_type\x18\x04 \x01(\tR\vcontentType\x12\x1a\n" +
+	"\blatitude\x18\x05 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\x06 \x01(\x01R\tlongitude\x12;\n" +
+	"\vcaptured_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"capturedAt\"b\n" +
 	"\x16DeliveryCompletedEvent\x12\x19\n" +
-	"\border_id\x18\x02 \x01(\x05R\aorderIdB\x1aZ\x18delivery/internal/eventsb\x06proto3"
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x12-\n" +
+	"\x05proof\x18\x03 \x01(\v2\x17.events.ProofOfDeliveryR\x05proof\"\xdf\x01\n" +
+	"\x13DeliveryFailedEvent\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x125\n" +
+	"\x06reason\x18\x03 \x01(\x0e2\x1d.events.DeliveryFailureReasonR\x06reason\x12\x18\n" +
+	"\adetails\x18\x04 \x01(\tR\adetails\x12\x18\n" +
+	"\aattempt\x18\x05 \x01(\x05R\aattempt\x12%\n" +
+	"\x0ewill_reattempt\x18\x06 \x01(\bR\rwillReattempt\x12\x1b\n" +
+	"\tdriver_id\x18\a \x01(\tR\bdriverId*\xcc\x01\n" +
+	"\x15DeliveryFailureReason\x12'\n" +
+	"#DELIVERY_FAILURE_REASON_UNSPECIFIED\x10\x00\x120\n" +
+	",DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE\x10\x01\x12+\n" +
+	"'DELIVERY_FAILURE_REASON_ADDRESS_INVALID\x10\x02\x12+\n" +
+	"'DELIVERY_FAILURE_REASON_DRIVER_INCIDENT\x10\x03B\x1aZ\x18delivery/internal/eventsb\x06proto3"
 
 var (
 	file_proto_events_delivery_proto_rawDescOnce sync.Once
@@ -261,20 +537,29 @@ func file_proto_events_delivery_proto_rawDescGZIP() []byte {
 	return file_proto_events_delivery_proto_rawDescData
 }
 
-var file_proto_events_delivery_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_events_delivery_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_events_delivery_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_proto_events_delivery_proto_goTypes = []any{
-	(*OrderItem)(nil),                  // 0: events.OrderItem
-	(*OrderReadyForDeliveryEvent)(nil), // 1: events.OrderReadyForDeliveryEvent
-	(*DeliveryStartedEvent)(nil),       // 2: events.DeliveryStartedEvent
-	(*DeliveryCompletedEvent)(nil),     // 3: events.DeliveryCompletedEvent
+	(DeliveryFailureReason)(0),         // 0: events.DeliveryFailureReason
+	(*OrderItem)(nil),                  // 1: events.OrderItem
+	(*OrderReadyForDeliveryEvent)(nil), // 2: events.OrderReadyForDeliveryEvent
+	(*DeliveryStartedEvent)(nil),       // 3: events.DeliveryStartedEvent
+	(*ProofOfDelivery)(nil),            // 4: events.ProofOfDelivery
+	(*DeliveryCompletedEvent)(nil),     // 5: events.DeliveryCompletedEvent
+	(*DeliveryFailedEvent)(nil),        // 6: events.DeliveryFailedEvent
+	(*timestamppb.Timestamp)(nil),      // 7: google.protobuf.Timestamp
 }
 var file_proto_events_delivery_proto_depIdxs = []int32{
-	0, // 0: events.OrderReadyForDeliveryEvent.items:type_name -> events.OrderItem
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	1, // 0: events.OrderReadyForDeliveryEvent.items:type_name -> events.OrderItem
+	7, // 1: events.DeliveryStartedEvent.estimated_arrival_at:type_name -> google.protobuf.Timestamp
+	7, // 2: events.ProofOfDelivery.captured_at:type_name -> google.protobuf.Timestamp
+	4, // 3: events.DeliveryCompletedEvent.proof:type_name -> events.ProofOfDelivery
+	0, // 4: events.DeliveryFailedEvent.reason:type_name -> events.DeliveryFailureReason
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_proto_events_delivery_proto_init() }
@@ -287,13 +572,14 @@ func file_proto_events_delivery_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_events_delivery_proto_rawDesc), len(file_proto_events_delivery_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   4,
+			NumEnums:      1,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_proto_events_delivery_proto_goTypes,
 		DependencyIndexes: file_proto_events_delivery_proto_depIdxs,
+		EnumInfos:         file_proto_events_delivery_proto_enumTypes,
 		MessageInfos:      file_proto_events_delivery_proto_msgTypes,
 	}.Build()
 	File_proto_events_delivery_proto = out.File
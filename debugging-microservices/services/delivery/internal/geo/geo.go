@@ -0,0 +1,43 @@
+package geo
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Haversine returns the great-circle distance between two points in
+// kilometers.
+func Haversine(a, b Point) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := (b.Latitude - a.Latitude) * math.Pi / 180
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// Offset returns the point distanceKm away from p in the direction of
+// bearing, in radians clockwise from north.
+func Offset(p Point, bearing, distanceKm float64) Point {
+	lat1 := p.Latitude * math.Pi / 180
+	lng1 := p.Longitude * math.Pi / 180
+	angular := distanceKm / earthRadiusKm
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angular) + math.Cos(lat1)*math.Sin(angular)*math.Cos(bearing))
+	lng2 := lng1 + math.Atan2(
+		math.Sin(bearing)*math.Sin(angular)*math.Cos(lat1),
+		math.Cos(angular)-math.Sin(lat1)*math.Sin(lat2),
+	)
+
+	return Point{
+		Latitude:  lat2 * 180 / math.Pi,
+		Longitude: lng2 * 180 / math.Pi,
+	}
+}
@@ -0,0 +1,126 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// fallbackRadiusKm is how far from the center unknown addresses are placed
+// when the static geocoder isn't strict.
+const fallbackRadiusKm = 5.0
+
+var defaultAddresses = map[string]Point{
+	"350 5th ave, new york, ny 10118":          {Latitude: 40.7484, Longitude: -73.9857},
+	"20 w 34th st, new york, ny 10001":         {Latitude: 40.7486, Longitude: -73.9864},
+	"175 5th ave, new york, ny 10010":          {Latitude: 40.7411, Longitude: -73.9897},
+	"1 e 161st st, bronx, ny 10451":            {Latitude: 40.8296, Longitude: -73.9262},
+	"89 e 42nd st, new york, ny 10017":         {Latitude: 40.7527, Longitude: -73.9772},
+	"1000 5th ave, new york, ny 10028":         {Latitude: 40.7794, Longitude: -73.9632},
+	"285 fulton st, new york, ny 10007":        {Latitude: 40.7127, Longitude: -74.0134},
+	"4 pennsylvania plaza, new york, ny 10001": {Latitude: 40.7505, Longitude: -73.9934},
+	"11 wall st, new york, ny 10005":           {Latitude: 40.7069, Longitude: -74.0113},
+	"1 centre st, new york, ny 10007":          {Latitude: 40.7130, Longitude: -74.0041},
+}
+
+// StaticGeocoder resolves addresses from a fixed table, for local runs
+// without a geocoding provider.
+type StaticGeocoder struct {
+	addresses map[string]Point
+	center    Point
+	strict    bool
+}
+
+// NewStaticGeocoder builds a geocoder from the built-in address table,
+// extended with the addresses in the JSON file at path, if any. The file maps
+// addresses to [latitude, longitude] pairs. Unless strict, addresses missing
+// from the table are placed at a stable spot near the center instead of
+// failing, since customers type whatever they like.
+func NewStaticGeocoder(path string, center Point, strict bool) (*StaticGeocoder, error) {
+	addresses := make(map[string]Point, len(defaultAddresses))
+	for address, point := range defaultAddresses {
+		addresses[address] = point
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("❌ Failed to read geocoder addresses: %w", err)
+		}
+
+		var table map[string][2]float64
+		if err := json.Unmarshal(data, &table); err != nil {
+			return nil, fmt.Errorf("❌ Failed to parse geocoder addresses: %w", err)
+		}
+
+		for address, point := range table {
+			addresses[normalizeAddress(address)] = Point{Latitude: point[0], Longitude: point[1]}
+		}
+	}
+
+	return &StaticGeocoder{
+		addresses: addresses,
+		center:    center,
+		strict:    strict,
+	}, nil
+}
+
+func (g *StaticGeocoder) Geocode(ctx context.Context, address string) (Point, error) {
+	normalized := normalizeAddress(address)
+	if normalized == "" {
+		return Point{}, ErrAddressNotFound
+	}
+
+	if point, ok := g.addresses[normalized]; ok {
+		return point, nil
+	}
+
+	if g.strict {
+		return Point{}, ErrAddressNotFound
+	}
+
+	// Hash the address to a bearing and distance so the same address always
+	// lands on the same spot
+	hash := fnv.New64a()
+	hash.Write([]byte(normalized))
+	sum := hash.Sum64()
+	bearing := float64(sum%3600) / 10 * math.Pi / 180
+	distanceKm := float64((sum>>16)%1000) / 1000 * fallbackRadiusKm
+
+	return Offset(g.center, bearing, distanceKm), nil
+}
+
+// HaversineRouter estimates routes from the straight-line distance, stretched
+// by a detour factor for the street grid, at a constant average speed.
+type HaversineRouter struct {
+	speedKmh     float64
+	detourFactor float64
+}
+
+func NewHaversineRouter(speedKmh, detourFactor float64) *HaversineRouter {
+	return &HaversineRouter{
+		speedKmh:     speedKmh,
+		detourFactor: detourFactor,
+	}
+}
+
+func (r *HaversineRouter) Route(ctx context.Context, from, to Point) (Route, error) {
+	distanceKm := Haversine(from, to) * r.detourFactor
+	duration := time.Duration(distanceKm / r.speedKmh * float64(time.Hour))
+
+	return Route{
+		DistanceKm: distanceKm,
+		Duration:   duration,
+	}, nil
+}
+
+// normalizeAddress lowercases an address and collapses its whitespace so
+// lookups don't depend on how it was typed.
+func normalizeAddress(address string) string {
+	return strings.Join(strings.Fields(strings.ToLower(address)), " ")
+}
@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPickupLocation = "40.7411,-73.9897"
+
+var ErrAddressNotFound = errors.New("address not found")
+
+// Geocoder resolves a delivery address to a point on the map.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (Point, error)
+}
+
+// Route is how far and how long it takes to drive between two points.
+type Route struct {
+	DistanceKm float64
+	Duration   time.Duration
+}
+
+// Router computes driving routes between two points.
+type Router interface {
+	Route(ctx context.Context, from, to Point) (Route, error)
+}
+
+// NewGeocoderFromEnv builds the geocoder selected by GEOCODER, traced as an
+// http.client span per call. Only the offline geocoder is available for now.
+func NewGeocoderFromEnv(center Point) (Geocoder, error) {
+	switch provider := getEnv("GEOCODER", "offline"); provider {
+	case "offline":
+		strict, err := strconv.ParseBool(getEnv("GEOCODER_STRICT", "false"))
+		if err != nil {
+			return nil, fmt.Errorf("❌ Invalid GEOCODER_STRICT: %w", err)
+		}
+
+		geocoder, err := NewStaticGeocoder(os.Getenv("GEOCODER_ADDRESSES"), center, strict)
+		if err != nil {
+			return nil, err
+		}
+		return NewTracedGeocoder(geocoder, provider), nil
+	default:
+		return nil, fmt.Errorf("❌ Unknown GEOCODER %q", provider)
+	}
+}
+
+// NewRouterFromEnv builds the router selected by ROUTER, traced as an
+// http.client span per call. Only the offline router is available for now.
+func NewRouterFromEnv() (Router, error) {
+	switch provider := getEnv("ROUTER", "offline"); provider {
+	case "offline":
+		speedKmh, err := strconv.ParseFloat(getEnv("ROUTER_SPEED_KMH", "25"), 64)
+		if err != nil || speedKmh <= 0 {
+			return nil, fmt.Errorf("❌ Invalid ROUTER_SPEED_KMH %q", os.Getenv("ROUTER_SPEED_KMH"))
+		}
+
+		detourFactor, err := strconv.ParseFloat(getEnv("ROUTER_DETOUR_FACTOR", "1.3"), 64)
+		if err != nil || detourFactor < 1 {
+			return nil, fmt.Errorf("❌ Invalid ROUTER_DETOUR_FACTOR %q", os.Getenv("ROUTER_DETOUR_FACTOR"))
+		}
+
+		return NewTracedRouter(NewHaversineRouter(speedKmh, detourFactor), provider), nil
+	default:
+		return nil, fmt.Errorf("❌ Unknown ROUTER %q", provider)
+	}
+}
+
+// PickupFromEnv returns where drivers collect orders from, set as
+// "latitude,longitude" in DELIVERY_PICKUP_LOCATION.
+func PickupFromEnv() (Point, error) {
+	pickup, err := ParsePoint(getEnv("DELIVERY_PICKUP_LOCATION", defaultPickupLocation))
+	if err != nil {
+		return Point{}, fmt.Errorf("❌ Invalid DELIVERY_PICKUP_LOCATION: %w", err)
+	}
+	return pickup, nil
+}
+
+// ParsePoint parses "latitude,longitude" pairs.
+func ParsePoint(value string) (Point, error) {
+	lat, lng, ok := strings.Cut(value, ",")
+	if !ok {
+		return Point{}, fmt.Errorf("expected latitude,longitude, got %q", value)
+	}
+
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	if err != nil {
+		return Point{}, err
+	}
+
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if err != nil {
+		return Point{}, err
+	}
+
+	return Point{Latitude: latitude, Longitude: longitude}, nil
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,86 @@
+package geo
+
+import (
+	"context"
+	"delivery/internal/platform/tracing"
+	"errors"
+	"fmt"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// TracedGeocoder records every call of the wrapped geocoder as an
+// http.client span, the way a call to a hosted provider would show up.
+type TracedGeocoder struct {
+	geocoder Geocoder
+	provider string
+}
+
+func NewTracedGeocoder(geocoder Geocoder, provider string) *TracedGeocoder {
+	return &TracedGeocoder{geocoder: geocoder, provider: provider}
+}
+
+func (g *TracedGeocoder) Geocode(ctx context.Context, address string) (Point, error) {
+	span := startProviderSpan(ctx, g.provider, "geocode")
+	span.SetData("geo.address", address)
+	defer span.Finish()
+
+	point, err := g.geocoder.Geocode(ctx, address)
+	if err != nil {
+		finishWithError(span, err)
+		return Point{}, err
+	}
+
+	span.SetData("geo.latitude", point.Latitude)
+	span.SetData("geo.longitude", point.Longitude)
+	span.Status = sentry.SpanStatusOK
+
+	return point, nil
+}
+
+// TracedRouter records every call of the wrapped router as an http.client
+// span.
+type TracedRouter struct {
+	router   Router
+	provider string
+}
+
+func NewTracedRouter(router Router, provider string) *TracedRouter {
+	return &TracedRouter{router: router, provider: provider}
+}
+
+func (r *TracedRouter) Route(ctx context.Context, from, to Point) (Route, error) {
+	span := startProviderSpan(ctx, r.provider, "route")
+	span.SetData("geo.from", fmt.Sprintf("%f,%f", from.Latitude, from.Longitude))
+	span.SetData("geo.to", fmt.Sprintf("%f,%f", to.Latitude, to.Longitude))
+	defer span.Finish()
+
+	route, err := r.router.Route(ctx, from, to)
+	if err != nil {
+		finishWithError(span, err)
+		return Route{}, err
+	}
+
+	span.SetData("geo.distance_km", route.DistanceKm)
+	span.SetData("geo.duration_ms", route.Duration.Milliseconds())
+	span.Status = sentry.SpanStatusOK
+
+	return route, nil
+}
+
+func startProviderSpan(ctx context.Context, provider, operation string) *tracing.Span {
+	span := tracing.StartSpan(ctx, "http.client", fmt.Sprintf("GET %s/%s", provider, operation))
+	span.SetData("http.request.method", "GET")
+	span.SetData("server.address", provider)
+	span.SetData("geo.provider", provider)
+	return span
+}
+
+func finishWithError(span *tracing.Span, err error) {
+	if errors.Is(err, ErrAddressNotFound) {
+		span.Status = sentry.SpanStatusNotFound
+		span.SetData("http.response.status_code", 404)
+		return
+	}
+	span.Status = sentry.SpanStatusInternalError
+}
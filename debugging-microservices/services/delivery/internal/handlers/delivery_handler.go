@@ -2,28 +2,481 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"delivery/internal/blobstore"
+	"delivery/internal/config"
 	"delivery/internal/events"
+	"delivery/internal/geo"
 	"delivery/internal/messaging"
+	"delivery/internal/models"
+	"delivery/internal/platform/dynconfig"
+	"delivery/internal/platform/logging"
+	"delivery/internal/repository"
+	"delivery/internal/tracking"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"math/rand"
 	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/getsentry/sentry-go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxProofUploadSize = 10 << 20
+	// candidateDrivers is how many of the closest free drivers, as the crow
+	// flies, get a routed ETA to the pickup when assigning one.
+	candidateDrivers = 3
+	// minRetryBackoff and maxRetryBackoff bound the wait between retries of a
+	// delivery step that failed, such as geocoding or publishing.
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
 )
 
 type DeliveryHandler struct {
 	rabbitmq *messaging.RabbitMQClient
+	repo     *repository.DeliveryRepository
+	tracking *tracking.Hub
+	blobs    blobstore.Store
+	geocoder geo.Geocoder
+	router   geo.Router
+
+	// pickup is where drivers collect orders from, used to find the closest
+	// free driver.
+	pickup geo.Point
+	// config holds the settings that can change at runtime, such as the
+	// simulated failure rate.
+	config *dynconfig.Watcher[config.Config]
+	// spawn runs deliveries in the background, in a context that's cancelled
+	// on shutdown, which waits for them.
+	spawn func(task func(ctx context.Context))
+
+	mu sync.Mutex
+	// averageDeliveryTime is a moving average of how long deliveries took
+	// from pickup to drop-off, used to estimate arrival times.
+	averageDeliveryTime time.Duration
+	// driverFreed is closed and replaced whenever a delivery frees a driver.
+	driverFreed chan struct{}
+	// active holds every delivery being worked on in this instance, so
+	// location pings can be marked on its transaction and drivers can cut it
+	// short.
+	active map[int]*activeDelivery
+
+	// streamsClosed is closed on shutdown to end the live tracking streams,
+	// which would otherwise keep the HTTP server from draining.
+	streamsClosed    chan struct{}
+	closeStreamsOnce sync.Once
+}
+
+type activeDelivery struct {
+	tx        *sentry.Span
+	cancel    context.CancelFunc
+	attempt   int
+	startedAt time.Time
 }
 
-func NewDeliveryHandler(rabbitmq *messaging.RabbitMQClient) *DeliveryHandler {
-	return &DeliveryHandler{rabbitmq: rabbitmq}
+var failureReasons = map[string]events.DeliveryFailureReason{
+	models.FailureReasonCustomerUnreachable: events.DeliveryFailureReason_DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE,
+	models.FailureReasonAddressInvalid:      events.DeliveryFailureReason_DELIVERY_FAILURE_REASON_ADDRESS_INVALID,
+	models.FailureReasonDriverIncident:      events.DeliveryFailureReason_DELIVERY_FAILURE_REASON_DRIVER_INCIDENT,
+}
+
+type failDeliveryRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+type locationRequest struct {
+	Latitude   float64    `json:"latitude"`
+	Longitude  float64    `json:"longitude"`
+	RecordedAt *time.Time `json:"recorded_at"`
+}
+
+type deliveryResponse struct {
+	models.Delivery
+	Location *models.DeliveryLocation
+}
+
+func NewDeliveryHandler(
+	rabbitmq *messaging.RabbitMQClient,
+	repo *repository.DeliveryRepository,
+	blobs blobstore.Store,
+	geocoder geo.Geocoder,
+	router geo.Router,
+	pickup geo.Point,
+	config *dynconfig.Watcher[config.Config],
+	spawn func(task func(ctx context.Context)),
+) *DeliveryHandler {
+	return &DeliveryHandler{
+		rabbitmq:            rabbitmq,
+		repo:                repo,
+		tracking:            tracking.NewHub(),
+		blobs:               blobs,
+		geocoder:            geocoder,
+		router:              router,
+		pickup:              pickup,
+		config:              config,
+		spawn:               spawn,
+		averageDeliveryTime: 25 * time.Second,
+		streamsClosed:       make(chan struct{}),
+		driverFreed:         make(chan struct{}),
+		active:              make(map[int]*activeDelivery),
+	}
+}
+
+func (h *DeliveryHandler) HandleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	response, ok := h.loadDelivery(w, r, orderID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleRecordLocation stores a location ping from the driver of a delivery
+// that's on the road.
+func (h *DeliveryHandler) HandleRecordLocation(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	var req locationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 {
+		http.Error(w, "latitude or longitude out of range", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.repo.GetDelivery(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("no delivery for order %d", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if delivery.Status != models.DeliveryStatusAssigned || delivery.DriverID == nil {
+		http.Error(w, fmt.Sprintf("delivery of order %d is %s, not on the road", orderID, delivery.Status), http.StatusConflict)
+		return
+	}
+
+	location := &models.DeliveryLocation{
+		DeliveryID: delivery.ID,
+		DriverID:   *delivery.DriverID,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		RecordedAt: time.Now(),
+	}
+	if req.RecordedAt != nil {
+		location.RecordedAt = *req.RecordedAt
+	}
+
+	err = h.repo.RecordLocation(r.Context(), location)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.markLocation(orderID, location)
+	h.tracking.Publish(tracking.Update{
+		OrderID:  orderID,
+		Status:   delivery.Status,
+		DriverID: location.DriverID,
+		Location: location,
+		At:       location.RecordedAt,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(location)
 }
 
-func (h *DeliveryHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
+// HandleStreamDelivery streams a delivery's status and position as
+// Server-Sent Events until it's delivered or returned, or the client goes
+// away.
+func (h *DeliveryHandler) HandleStreamDelivery(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before loading the current state so no update falls in between
+	updates, unsubscribe := h.tracking.Subscribe(orderID)
+	defer unsubscribe()
+
+	response, ok := h.loadDelivery(w, r, orderID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+
+	writeEvent(r.Context(), w, "status", response)
+	flusher.Flush()
+	if finished(response.Status) {
+		return
+	}
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.streamsClosed:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case update := <-updates:
+			event := "status"
+			if update.Location != nil {
+				event = "location"
+			}
+			writeEvent(r.Context(), w, event, update)
+			flusher.Flush()
+			if finished(update.Status) {
+				return
+			}
+		}
+	}
+}
+
+// CloseStreams ends every live tracking stream. Clients are expected to
+// reconnect, landing on another instance.
+func (h *DeliveryHandler) CloseStreams() {
+	h.closeStreamsOnce.Do(func() {
+		close(h.streamsClosed)
+	})
+}
+
+// HandleFailDelivery lets the driver report that the delivery couldn't be
+// made. The delivery is reattempted or returned to the kitchen depending on
+// the reason and on how many attempts were already made.
+func (h *DeliveryHandler) HandleFailDelivery(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	var req failDeliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := failureReasons[req.Reason]; !ok {
+		http.Error(w, fmt.Sprintf("unknown failure reason %q", req.Reason), http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.repo.GetDelivery(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("no delivery for order %d", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	moved := false
+	if delivery.Status == models.DeliveryStatusAssigned {
+		// Published under the order's trace rather than the request's
+		tx := h.deliveryTransaction(r.Context(), delivery, "delivery.fail-delivery")
+		moved, err = h.failDelivery(tx.Context(), delivery, req.Reason, req.Details)
+		tx.Finish()
+		if err != nil {
+			sentry.CaptureException(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response, ok := h.loadDelivery(w, r, orderID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !moved {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleCompleteDelivery completes a delivery with its proof of delivery: a
+// multipart form with the recipient_name, the latitude and longitude where
+// the order was handed over, and a photo or signature file.
+func (h *DeliveryHandler) HandleCompleteDelivery(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxProofUploadSize)
+	if err := r.ParseMultipartForm(maxProofUploadSize); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipientName := strings.TrimSpace(r.FormValue("recipient_name"))
+	if recipientName == "" {
+		http.Error(w, "recipient_name is required", http.StatusBadRequest)
+		return
+	}
+
+	latitude, latErr := strconv.ParseFloat(r.FormValue("latitude"), 64)
+	longitude, lngErr := strconv.ParseFloat(r.FormValue("longitude"), 64)
+	if latErr != nil || lngErr != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		http.Error(w, "a valid latitude and longitude are required", http.StatusBadRequest)
+		return
+	}
+
+	kind := models.ProofKindPhoto
+	file, header, err := r.FormFile(models.ProofKindPhoto)
+	if errors.Is(err, http.ErrMissingFile) {
+		kind = models.ProofKindSignature
+		file, header, err = r.FormFile(models.ProofKindSignature)
+	}
+	if errors.Is(err, http.ErrMissingFile) {
+		http.Error(w, "a photo or signature file is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	delivery, err := h.repo.GetDelivery(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("no delivery for order %d", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	completed := false
+	if delivery.Status == models.DeliveryStatusAssigned {
+		proof := &models.ProofOfDelivery{
+			RecipientName: recipientName,
+			Kind:          kind,
+			Key:           fmt.Sprintf("proofs/%d/%s-%d-%d%s", orderID, kind, delivery.Attempt, time.Now().UnixNano(), filepath.Ext(header.Filename)),
+			ContentType:   header.Header.Get("Content-Type"),
+			Latitude:      latitude,
+			Longitude:     longitude,
+			CapturedAt:    time.Now(),
+		}
+		if proof.ContentType == "" {
+			proof.ContentType = "application/octet-stream"
+		}
+
+		err = h.storeProof(r.Context(), proof, file)
+		if err != nil {
+			sentry.CaptureException(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Published under the order's trace rather than the request's
+		tx := h.deliveryTransaction(r.Context(), delivery, "delivery.complete-delivery")
+		completed, err = h.completeDelivery(tx.Context(), delivery, proof)
+		tx.Finish()
+		if !completed {
+			// Nothing refers to the proof unless the delivery took it
+			if err := h.blobs.Delete(r.Context(), proof.Key); err != nil {
+				logging.Errorf(r.Context(), "❌ Failed to delete unused proof %s: %v", proof.Key, err)
+				sentry.CaptureException(err)
+			}
+		}
+		if err != nil {
+			sentry.CaptureException(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response, ok := h.loadDelivery(w, r, orderID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !completed {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetProof serves the photo or signature of a delivered order.
+func (h *DeliveryHandler) HandleGetProof(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.repo.GetDelivery(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && delivery.ProofKey == nil) {
+		http.Error(w, fmt.Sprintf("no proof of delivery for order %d", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	blob, err := h.blobs.Get(r.Context(), *delivery.ProofKey)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("proof of delivery for order %d is missing", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	if delivery.ProofContentType != nil {
+		w.Header().Set("Content-Type", *delivery.ProofContentType)
+	}
+	io.Copy(w, blob)
 }
 
 func (h *DeliveryHandler) HandleReadyForDelivery(
@@ -35,63 +488,673 @@ func (h *DeliveryHandler) HandleReadyForDelivery(
 ) error {
 	parentSpan := sentry.SpanFromContext(ctx)
 
-	go func() {
-		hub := sentry.GetHubFromContext(ctx)
-		if hub == nil {
-			hub = sentry.CurrentHub().Clone()
+	delivery := &models.Delivery{
+		OrderID:         int(orderID),
+		CustomerID:      customerID,
+		DeliveryAddress: deliveryAddress,
+		Status:          models.DeliveryStatusQueued,
+		SentryTrace:     parentSpan.ToSentryTrace(),
+		Baggage:         parentSpan.ToBaggage(),
+		CreatedAt:       time.Now(),
+	}
+
+	created, err := h.repo.CreateDelivery(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		logging.Infof(ctx, "♻️ Delivery for order %d already exists, skipping", orderID)
+		return nil
+	}
+
+	h.tracking.Publish(tracking.Update{
+		OrderID: delivery.OrderID,
+		Status:  delivery.Status,
+		At:      delivery.CreatedAt,
+	})
+
+	h.startDelivering(ctx, delivery)
+
+	return nil
+}
+
+// ResumeDeliveries picks up the deliveries that were waiting for a driver or
+// on the road when the service stopped.
+func (h *DeliveryHandler) ResumeDeliveries(ctx context.Context) error {
+	resumeTx := sentry.StartTransaction(ctx, "delivery.resume-deliveries")
+	resumeTx.Source = sentry.SourceTask
+	defer resumeTx.Finish()
+
+	deliveries, err := h.repo.ListUnfinishedDeliveries(resumeTx.Context())
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		logging.Infof(ctx, "♻️ Resuming %s delivery for order %d", delivery.Status, delivery.OrderID)
+		h.startDelivering(ctx, delivery)
+	}
+
+	resumeTx.SetData("deliveries.resumed", len(deliveries))
+
+	return nil
+}
+
+// startDelivering works on a delivery in the background until it's
+// completed, failed or the service shuts down, in which case it's resumed on
+// restart.
+func (h *DeliveryHandler) startDelivering(ctx context.Context, delivery *models.Delivery) {
+	h.spawn(func(runCtx context.Context) {
+		h.deliver(ctx, runCtx, delivery)
+	})
+}
+
+func (h *DeliveryHandler) deliver(ctx context.Context, runCtx context.Context, delivery *models.Delivery) {
+	deliveryTx := h.deliveryTransaction(ctx, delivery, "delivery")
+	defer deliveryTx.Finish()
+	deliveryCtx := deliveryTx.Context()
+
+	driveCtx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+
+	active := &activeDelivery{tx: deliveryTx, cancel: cancel, attempt: delivery.Attempt, startedAt: time.Now()}
+	h.mu.Lock()
+	h.active[delivery.OrderID] = active
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		if h.active[delivery.OrderID] == active {
+			delete(h.active, delivery.OrderID)
 		}
-		goCtx := sentry.SetHubOnContext(context.Background(), hub)
+		h.mu.Unlock()
+	}()
 
-		deliveryTx := sentry.StartTransaction(
-			goCtx,
-			"delivery",
-			sentry.ContinueFromHeaders(
-				parentSpan.ToSentryTrace(),
-				parentSpan.ToBaggage(),
-			),
-		)
-		deliveryTx.Source = sentry.SourceTask
+	orderID := int32(delivery.OrderID)
 
+	var dropoff geo.Point
+	var addressNotFound bool
+	err := h.retry(ctx, driveCtx, orderID, "geocode the address", func() error {
+		var err error
+		dropoff, err = h.resolveDropoff(deliveryCtx, delivery)
+		if errors.Is(err, geo.ErrAddressNotFound) {
+			addressNotFound = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		logging.Infof(ctx, "✋ Stopped delivering order %d", orderID)
+		return
+	}
+	if addressNotFound {
+		err = h.retry(ctx, driveCtx, orderID, "fail the delivery", func() error {
+			_, err := h.failDelivery(deliveryCtx, delivery, models.FailureReasonAddressInvalid,
+				fmt.Sprintf("could not geocode %q", delivery.DeliveryAddress))
+			return err
+		})
+		if err != nil {
+			logging.Infof(ctx, "✋ Stopped delivering order %d", orderID)
+		}
+		return
+	}
+
+	var driverID string
+	var toPickup geo.Route
+	if delivery.DriverID != nil {
+		driverID = *delivery.DriverID
+	} else {
 		assigningSpan := deliveryTx.StartChild("function", []sentry.SpanOption{
 			sentry.WithDescription("delivery.assigning-driver"),
 		}...)
 		assigningSpan.SetData("order.id", orderID)
-		time.Sleep(time.Duration(rand.Intn(10000)+20000) * time.Millisecond)
-		assigningSpan.SetData("driver.id", "lazar.nikolov")
+		var driver *models.Driver
+		err = h.retry(ctx, driveCtx, orderID, "assign a driver", func() error {
+			var err error
+			driver, toPickup, err = h.assignDriver(assigningSpan.Context(), delivery.OrderID)
+			return err
+		})
+		if err != nil {
+			logging.Infof(ctx, "✋ Stopped delivering order %d", orderID)
+			assigningSpan.Finish()
+			return
+		}
+		assigningSpan.SetData("driver.id", driver.ID)
+		assigningSpan.SetData("driver.distance_km", toPickup.DistanceKm)
+		assigningSpan.SetData("driver.eta_to_pickup_ms", toPickup.Duration.Milliseconds())
 		assigningSpan.Finish()
 
-		// Publish delivery started using the assigning transaction's context
-		err := h.rabbitmq.PublishDeliveryStarted(deliveryTx.Context(), orderID)
+		logging.Infof(ctx, "🛵 Driver %s assigned to order %d", driver.ID, orderID)
+		driverID = driver.ID
+		assignedAt := time.Now()
+		delivery.DriverID = &driverID
+		delivery.AssignedAt = &assignedAt
+		delivery.Status = models.DeliveryStatusAssigned
+
+		h.tracking.Publish(tracking.Update{
+			OrderID:  delivery.OrderID,
+			Status:   models.DeliveryStatusAssigned,
+			DriverID: driverID,
+			At:       time.Now(),
+		})
+	}
+
+	travelTime := h.estimateDeliveryTime()
+	toDropoff, err := h.router.Route(deliveryCtx, h.pickup, dropoff)
+	if err != nil {
+		logging.Errorf(ctx, "❌ Failed to route order %d, falling back to the average delivery time: %v", orderID, err)
+		sentry.CaptureException(err)
+	} else {
+		travelTime = h.scale(toPickup.Duration + toDropoff.Duration)
+		deliveryTx.SetData("delivery.distance_km", toPickup.DistanceKm+toDropoff.DistanceKm)
+	}
+
+	estimatedArrivalAt := time.Now().Add(travelTime)
+	deliveryTx.SetData("delivery.estimated_arrival_at", estimatedArrivalAt.Format(time.RFC3339))
+	deliveryTx.SetData("delivery.attempt", delivery.Attempt)
+
+	// Publish delivery started using the assigning transaction's context
+	err = h.retry(ctx, driveCtx, orderID, "publish the delivery started event", func() error {
+		return h.rabbitmq.PublishDeliveryStarted(deliveryCtx, orderID, driverID, estimatedArrivalAt)
+	})
+	if err != nil {
+		logging.Infof(ctx, "✋ Stopped delivering order %d", orderID)
+		return
+	}
+
+	logging.Infof(ctx, "✅ Delivery started event published for order %d", orderID)
+
+	deliveryTx.StartChild("mark", []sentry.SpanOption{
+		sentry.WithDescription(fmt.Sprintf("delivery.started-%d", orderID)),
+	}...).Finish()
+
+	if !h.config.Current().AutoComplete {
+		// Wait for the driver to complete or fail the delivery over HTTP
+		<-driveCtx.Done()
+		return
+	}
+
+	// Simulate delivery time, give or take a fifth of the route
+	select {
+	case <-time.After(time.Duration(float64(travelTime) * (0.8 + rand.Float64()*0.4))):
+	case <-driveCtx.Done():
+		logging.Infof(ctx, "✋ Stopped delivering order %d", orderID)
+		return
+	}
+
+	if rand.Float64() < h.config.Current().FailureRate {
+		reasons := []string{
+			models.FailureReasonCustomerUnreachable,
+			models.FailureReasonAddressInvalid,
+			models.FailureReasonDriverIncident,
+		}
+		_, err := h.failDelivery(deliveryCtx, delivery, reasons[rand.Intn(len(reasons))], "simulated failure")
 		if err != nil {
-			log.Printf("❌ AMQP: Failed to publish delivery started event: %v", err)
-			deliveryTx.Finish()
-			return
+			logging.Errorf(ctx, "❌ Failed to fail delivery of order %d: %v", orderID, err)
+			sentry.CaptureException(err)
 		}
+		return
+	}
+
+	_, err = h.completeDelivery(deliveryCtx, delivery, nil)
+	if err != nil {
+		logging.Errorf(ctx, "❌ Failed to complete delivery of order %d: %v", orderID, err)
+		sentry.CaptureException(err)
+	}
+}
+
+// ActiveDelivery describes a delivery whose goroutine is running.
+type ActiveDelivery struct {
+	OrderID   int       `json:"order_id"`
+	Attempt   int       `json:"attempt"`
+	TraceID   string    `json:"trace_id"`
+	StartedAt time.Time `json:"started_at"`
+	Age       string    `json:"age"`
+}
 
-		log.Printf("✅ Delivery started event published for order %d", orderID)
+// Active returns the deliveries being worked on in this instance, oldest
+// first.
+func (h *DeliveryHandler) Active() []ActiveDelivery {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-		deliveryTx.StartChild("mark", []sentry.SpanOption{
-			sentry.WithDescription(fmt.Sprintf("delivery.started-%d", orderID)),
-		}...).Finish()
+	deliveries := make([]ActiveDelivery, 0, len(h.active))
+	for orderID, active := range h.active {
+		deliveries = append(deliveries, ActiveDelivery{
+			OrderID:   orderID,
+			Attempt:   active.attempt,
+			TraceID:   active.tx.TraceID.String(),
+			StartedAt: active.startedAt,
+			Age:       time.Since(active.startedAt).Round(time.Millisecond).String(),
+		})
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].StartedAt.Before(deliveries[j].StartedAt)
+	})
 
-		// Simulate delivery time
-		time.Sleep(time.Duration(rand.Intn(10000)+20000) * time.Millisecond)
+	return deliveries
+}
+
+// retry runs step until it succeeds, backing off between attempts, so a
+// geocoder, database or broker hiccup doesn't leave the delivery stuck. Only
+// the first failure is reported to Sentry. It gives up once driveCtx is done,
+// i.e. when the attempt is cut short.
+func (h *DeliveryHandler) retry(ctx, driveCtx context.Context, orderID int32, step string, fn func() error) error {
+	backoff := minRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt == 1 {
+			sentry.CaptureException(err)
+		}
+		logging.Warnf(ctx, "⚠️ Failed to %s for order %d (attempt %d), retrying in %s: %v", step, orderID, attempt, backoff, err)
 
-		deliveryTx.StartChild("mark", []sentry.SpanOption{
+		select {
+		case <-time.After(backoff):
+		case <-driveCtx.Done():
+			return driveCtx.Err()
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// completeDelivery marks a delivery as delivered, stops the attempt if it's
+// on the road in this instance and publishes the completion along with the
+// proof of delivery, if there is one. It reports false when the attempt had
+// already ended.
+func (h *DeliveryHandler) completeDelivery(ctx context.Context, delivery *models.Delivery, proof *models.ProofOfDelivery) (bool, error) {
+	orderID := int32(delivery.OrderID)
+
+	completed, err := h.repo.CompleteDelivery(ctx, delivery.OrderID, proof)
+	if err != nil || !completed {
+		return false, err
+	}
+
+	h.mu.Lock()
+	active := h.active[delivery.OrderID]
+	h.mu.Unlock()
+	if active != nil {
+		markSpan := active.tx.StartChild("mark", []sentry.SpanOption{
 			sentry.WithDescription(fmt.Sprintf("delivery.completed-%d", orderID)),
-		}...).Finish()
+		}...)
+		if proof != nil {
+			markSpan.SetData("delivery.proof_kind", proof.Kind)
+		}
+		markSpan.Finish()
+		active.cancel()
+	}
+
+	if delivery.AssignedAt != nil {
+		h.recordDeliveryTime(time.Since(*delivery.AssignedAt))
+	}
+
+	h.notifyDriverFreed()
+
+	driverID := ""
+	if delivery.DriverID != nil {
+		driverID = *delivery.DriverID
+	}
+	h.tracking.Publish(tracking.Update{
+		OrderID:  delivery.OrderID,
+		Status:   models.DeliveryStatusDelivered,
+		DriverID: driverID,
+		At:       time.Now(),
+	})
+
+	var proofEvent *events.ProofOfDelivery
+	if proof != nil {
+		proofEvent = &events.ProofOfDelivery{
+			RecipientName: proof.RecipientName,
+			Kind:          proof.Kind,
+			Url:           fmt.Sprintf("/deliveries/%d/proof", orderID),
+			ContentType:   proof.ContentType,
+			Latitude:      proof.Latitude,
+			Longitude:     proof.Longitude,
+			CapturedAt:    timestamppb.New(proof.CapturedAt),
+		}
+	}
+
+	// Publish delivery completed using the complete transaction's context
+	h.publish(ctx, orderID, "publish delivery completed", func(ctx context.Context) error {
+		return h.rabbitmq.PublishDeliveryCompleted(ctx, orderID, proofEvent)
+	})
 
-		// Publish delivery completed using the complete transaction's context
-		err = h.rabbitmq.PublishDeliveryCompleted(deliveryTx.Context(), orderID)
+	return true, nil
+}
+
+// publish publishes an event about a delivery whose state has already
+// moved on, so it has to go out eventually. When the first attempt fails,
+// it keeps retrying in the background until it succeeds or the service
+// shuts down.
+func (h *DeliveryHandler) publish(ctx context.Context, orderID int32, step string, fn func(ctx context.Context) error) {
+	err := fn(ctx)
+	if err == nil {
+		return
+	}
+	logging.Errorf(ctx, "%v, retrying in the background", err)
+
+	// The request or attempt that moved the delivery on is over by now
+	ctx = context.WithoutCancel(ctx)
+	h.spawn(func(runCtx context.Context) {
+		if err := h.retry(ctx, runCtx, orderID, step, func() error { return fn(ctx) }); err != nil {
+			logging.Errorf(ctx, "❌ Gave up trying to %s for order %d at shutdown", step, orderID)
+		}
+	})
+}
+
+// storeProof uploads the photo or signature of a proof of delivery to the
+// blob store.
+func (h *DeliveryHandler) storeProof(ctx context.Context, proof *models.ProofOfDelivery, r io.Reader) error {
+	parentSpan := sentry.SpanFromContext(ctx)
+
+	storeSpan := parentSpan.StartChild("file.write", []sentry.SpanOption{
+		sentry.WithDescription(proof.Key),
+	}...)
+	storeSpan.SetData("delivery.proof_kind", proof.Kind)
+	storeSpan.SetData("delivery.proof_content_type", proof.ContentType)
+	err := h.blobs.Put(ctx, proof.Key, r)
+	storeSpan.Finish()
+
+	return err
+}
+
+// failDelivery records a failed attempt, stops the attempt if it's on the road
+// in this instance and publishes the failure. Failures other than an invalid
+// address are reattempted until the attempts run out, after which the order
+// is returned to the kitchen. It reports false when the attempt had already
+// ended.
+func (h *DeliveryHandler) failDelivery(ctx context.Context, delivery *models.Delivery, reason, details string) (bool, error) {
+	orderID := int32(delivery.OrderID)
+	reattempt := reason != models.FailureReasonAddressInvalid && delivery.Attempt < h.config.Current().MaxAttempts
+
+	moved, err := h.repo.FailDelivery(ctx, delivery, reason, details, reattempt)
+	if err != nil || !moved {
+		return false, err
+	}
+
+	logging.Warnf(ctx, "🚫 Delivery attempt %d of order %d failed: %s (reattempt: %v)", delivery.Attempt, orderID, reason, reattempt)
+
+	h.mu.Lock()
+	active := h.active[delivery.OrderID]
+	h.mu.Unlock()
+	if active != nil {
+		markSpan := active.tx.StartChild("mark", []sentry.SpanOption{
+			sentry.WithDescription(fmt.Sprintf("delivery.failed-%d", orderID)),
+		}...)
+		markSpan.SetData("delivery.failure_reason", reason)
+		markSpan.SetData("delivery.attempt", delivery.Attempt)
+		markSpan.SetData("delivery.will_reattempt", reattempt)
+		markSpan.Finish()
+		active.cancel()
+	}
+
+	h.notifyDriverFreed()
+
+	driverID := ""
+	if delivery.DriverID != nil {
+		driverID = *delivery.DriverID
+	}
+
+	status := models.DeliveryStatusReturned
+	if reattempt {
+		status = models.DeliveryStatusQueued
+	}
+	h.tracking.Publish(tracking.Update{
+		OrderID:  delivery.OrderID,
+		Status:   status,
+		DriverID: driverID,
+		At:       time.Now(),
+	})
+
+	failed := &events.DeliveryFailedEvent{
+		OrderId:       orderID,
+		Reason:        failureReasons[reason],
+		Details:       details,
+		Attempt:       int32(delivery.Attempt),
+		WillReattempt: reattempt,
+		DriverId:      driverID,
+	}
+	h.publish(ctx, orderID, "publish delivery failed", func(ctx context.Context) error {
+		return h.rabbitmq.PublishDeliveryFailed(ctx, failed)
+	})
+
+	if reattempt {
+		next, err := h.repo.GetDelivery(ctx, delivery.OrderID)
 		if err != nil {
-			log.Printf("❌ AMQP: Failed to publish delivery completed event: %v", err)
-			deliveryTx.Finish()
-			return
+			return true, err
 		}
+		h.startDelivering(ctx, next)
+	}
 
-		log.Printf("✅ Delivery completed event published for order %d", orderID)
-		deliveryTx.Finish()
-	}()
+	return true, nil
+}
 
-	return nil
+// assignDriver assigns the free driver that can get to the pickup the
+// soonest, waiting in the queue for one to free up when every driver is busy.
+// It returns the assigned driver along with its route to the pickup.
+func (h *DeliveryHandler) assignDriver(ctx context.Context, orderID int) (*models.Driver, geo.Route, error) {
+	parentSpan := sentry.SpanFromContext(ctx)
+
+	var waitSpan *sentry.Span
+	finishWait := func(attempts int) {
+		if waitSpan != nil {
+			waitSpan.SetData("delivery.assignment_attempts", attempts)
+			waitSpan.Finish()
+		}
+	}
+
+	attempts := 0
+	for {
+		h.mu.Lock()
+		driverFreed := h.driverFreed
+		h.mu.Unlock()
+
+		attempts++
+		drivers, err := h.repo.ListFreeDrivers(ctx)
+		if err != nil {
+			finishWait(attempts)
+			return nil, geo.Route{}, err
+		}
+
+		driver, route, err := h.closestDriver(ctx, drivers)
+		if err != nil {
+			finishWait(attempts)
+			return nil, geo.Route{}, err
+		}
+
+		if driver != nil {
+			assigned, err := h.repo.AssignDriver(ctx, orderID, driver.ID)
+			if err != nil {
+				finishWait(attempts)
+				return nil, geo.Route{}, err
+			}
+			if assigned {
+				finishWait(attempts)
+				return driver, route, nil
+			}
+
+			// Someone else got the driver first, look again right away
+			continue
+		}
+
+		if waitSpan == nil {
+			logging.Infof(ctx, "⏳ No free drivers, order %d is queued", orderID)
+			waitSpan = parentSpan.StartChild("queue.wait", []sentry.SpanOption{
+				sentry.WithDescription("delivery.waiting-for-driver"),
+			}...)
+			waitSpan.SetData("order.id", orderID)
+		}
+
+		select {
+		case <-driverFreed:
+		case <-time.After(h.config.Current().AssignmentRetryInterval):
+		case <-ctx.Done():
+			finishWait(attempts)
+			return nil, geo.Route{}, ctx.Err()
+		}
+	}
+}
+
+// closestDriver routes the drivers closest to the pickup as the crow flies
+// and returns the one with the shortest drive there, or nil when there are no
+// drivers.
+func (h *DeliveryHandler) closestDriver(ctx context.Context, drivers []*models.Driver) (*models.Driver, geo.Route, error) {
+	location := func(driver *models.Driver) geo.Point {
+		return geo.Point{Latitude: driver.Latitude, Longitude: driver.Longitude}
+	}
+
+	sort.Slice(drivers, func(i, j int) bool {
+		return geo.Haversine(h.pickup, location(drivers[i])) < geo.Haversine(h.pickup, location(drivers[j]))
+	})
+	if len(drivers) > candidateDrivers {
+		drivers = drivers[:candidateDrivers]
+	}
+
+	var closest *models.Driver
+	var closestRoute geo.Route
+	for _, driver := range drivers {
+		route, err := h.router.Route(ctx, location(driver), h.pickup)
+		if err != nil {
+			return nil, geo.Route{}, err
+		}
+		if closest == nil || route.Duration < closestRoute.Duration {
+			closest = driver
+			closestRoute = route
+		}
+	}
+
+	return closest, closestRoute, nil
+}
+
+// resolveDropoff geocodes the delivery address, once per delivery.
+func (h *DeliveryHandler) resolveDropoff(ctx context.Context, delivery *models.Delivery) (geo.Point, error) {
+	if delivery.DropoffLatitude != nil && delivery.DropoffLongitude != nil {
+		return geo.Point{Latitude: *delivery.DropoffLatitude, Longitude: *delivery.DropoffLongitude}, nil
+	}
+
+	dropoff, err := h.geocoder.Geocode(ctx, delivery.DeliveryAddress)
+	if err != nil {
+		return geo.Point{}, err
+	}
+
+	err = h.repo.SetDropoff(ctx, delivery.OrderID, dropoff)
+	if err != nil {
+		return geo.Point{}, err
+	}
+	delivery.DropoffLatitude = &dropoff.Latitude
+	delivery.DropoffLongitude = &dropoff.Longitude
+
+	return dropoff, nil
+}
+
+// scale compresses a real travel time by the handler's time scale.
+func (h *DeliveryHandler) scale(duration time.Duration) time.Duration {
+	return time.Duration(float64(duration) * h.config.Current().TimeScale)
+}
+
+// markLocation marks a location ping on the delivery transaction of the
+// order, if it's on the road in this instance.
+func (h *DeliveryHandler) markLocation(orderID int, location *models.DeliveryLocation) {
+	h.mu.Lock()
+	active := h.active[orderID]
+	h.mu.Unlock()
+
+	if active == nil {
+		return
+	}
+
+	markSpan := active.tx.StartChild("mark", []sentry.SpanOption{
+		sentry.WithDescription(fmt.Sprintf("delivery.location-%d", orderID)),
+	}...)
+	markSpan.SetData("driver.id", location.DriverID)
+	markSpan.SetData("location.latitude", location.Latitude)
+	markSpan.SetData("location.longitude", location.Longitude)
+	markSpan.SetData("location.recorded_at", location.RecordedAt.Format(time.RFC3339))
+	markSpan.Finish()
+}
+
+func (h *DeliveryHandler) loadDelivery(w http.ResponseWriter, r *http.Request, orderID int) (*deliveryResponse, bool) {
+	delivery, err := h.repo.GetDelivery(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("no delivery for order %d", orderID), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	location, err := h.repo.LatestLocation(r.Context(), delivery.ID)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &deliveryResponse{Delivery: *delivery, Location: location}, true
+}
+
+// notifyDriverFreed wakes up the deliveries waiting for a driver.
+func (h *DeliveryHandler) notifyDriverFreed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	close(h.driverFreed)
+	h.driverFreed = make(chan struct{})
+}
+
+func (h *DeliveryHandler) deliveryTransaction(ctx context.Context, delivery *models.Delivery, name string) *sentry.Span {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+	}
+	goCtx := logging.WithOrderID(sentry.SetHubOnContext(context.Background(), hub), delivery.OrderID)
+
+	tx := sentry.StartTransaction(
+		goCtx,
+		name,
+		sentry.ContinueFromHeaders(delivery.SentryTrace, delivery.Baggage),
+	)
+	tx.Source = sentry.SourceTask
+	tx.SetData("order.id", delivery.OrderID)
+
+	return tx
+}
+
+func (h *DeliveryHandler) estimateDeliveryTime() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.averageDeliveryTime
+}
+
+// recordDeliveryTime folds a finished delivery into the moving average.
+func (h *DeliveryHandler) recordDeliveryTime(duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.averageDeliveryTime = (h.averageDeliveryTime*4 + duration) / 5
+}
+
+// finished reports whether a delivery in the given status is over.
+func finished(status string) bool {
+	return status == models.DeliveryStatusDelivered || status == models.DeliveryStatusReturned
+}
+
+func writeEvent(ctx context.Context, w http.ResponseWriter, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logging.Errorf(ctx, "❌ Failed to encode %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+func parseOrderID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	orderID, err := strconv.Atoi(r.PathValue("orderId"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return 0, false
+	}
+	return orderID, true
 }
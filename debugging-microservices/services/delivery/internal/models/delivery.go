@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+const (
+	DeliveryStatusQueued    = "queued"
+	DeliveryStatusAssigned  = "assigned"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusReturned  = "returned"
+)
+
+const (
+	ProofKindPhoto     = "photo"
+	ProofKindSignature = "signature"
+)
+
+const (
+	FailureReasonCustomerUnreachable = "customer_unreachable"
+	FailureReasonAddressInvalid      = "address_invalid"
+	FailureReasonDriverIncident      = "driver_incident"
+)
+
+type Driver struct {
+	ID               string    `db:"id"`
+	Name             string    `db:"name"`
+	Available        bool      `db:"available"`
+	Latitude         float64   `db:"latitude"`
+	Longitude        float64   `db:"longitude"`
+	Capacity         int       `db:"capacity"`
+	ActiveDeliveries int       `db:"active_deliveries"`
+	UpdatedAt        time.Time `db:"updated_at"`
+}
+
+type Delivery struct {
+	ID              int        `db:"id"`
+	OrderID         int        `db:"order_id"`
+	CustomerID      string     `db:"customer_id"`
+	DeliveryAddress string     `db:"delivery_address"`
+	DriverID        *string    `db:"driver_id"`
+	Status          string     `db:"status"` // queued, assigned, delivered, returned
+	Attempt         int        `db:"attempt"`
+	FailureReason   *string    `db:"failure_reason"`
+	FailureDetails  *string    `db:"failure_details"`
+	SentryTrace     string     `db:"sentry_trace"`
+	Baggage         string     `db:"baggage"`
+	CreatedAt       time.Time  `db:"created_at"`
+	AssignedAt      *time.Time `db:"assigned_at"`
+	CompletedAt     *time.Time `db:"completed_at"`
+	FailedAt        *time.Time `db:"failed_at"`
+
+	DropoffLatitude  *float64 `db:"dropoff_latitude"`
+	DropoffLongitude *float64 `db:"dropoff_longitude"`
+
+	RecipientName    *string  `db:"recipient_name"`
+	ProofKind        *string  `db:"proof_kind"`
+	ProofKey         *string  `db:"proof_key"`
+	ProofContentType *string  `db:"proof_content_type"`
+	ProofLatitude    *float64 `db:"proof_latitude"`
+	ProofLongitude   *float64 `db:"proof_longitude"`
+}
+
+// ProofOfDelivery is what the driver captures at the door: who took the
+// order, a photo or signature kept in the blob store, and where it happened.
+type ProofOfDelivery struct {
+	RecipientName string
+	Kind          string // photo, signature
+	Key           string
+	ContentType   string
+	Latitude      float64
+	Longitude     float64
+	CapturedAt    time.Time
+}
+
+type DeliveryLocation struct {
+	ID         int       `db:"id"`
+	DeliveryID int       `db:"delivery_id"`
+	DriverID   string    `db:"driver_id"`
+	Latitude   float64   `db:"latitude"`
+	Longitude  float64   `db:"longitude"`
+	RecordedAt time.Time `db:"recorded_at"`
+}
@@ -0,0 +1,234 @@
+package amqptrace
+
+import (
+	"context"
+	"delivery/internal/platform/faults"
+	"delivery/internal/platform/logging"
+	"delivery/internal/platform/metrics"
+	"delivery/internal/platform/tracing"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handler processes a message; ctx carries its queue.process transaction.
+// Returning nil acks the message, an error made with Reject rejects it and
+// any other error sends it to be tried again, up to MaxRedeliveries times
+// before it's rejected as well.
+type Handler func(ctx context.Context, msg *amqp.Delivery) error
+
+// MaxRedeliveries is how many times a message whose handler fails is tried
+// again before it's rejected.
+const MaxRedeliveries = 5
+
+const (
+	// RedeliveryHeader counts how many times a message has been sent back to
+	// be tried again.
+	RedeliveryHeader = "x-redelivery-count"
+	// RetryQueueHeader names the queue a message being tried again goes back
+	// to, which is what Retry.Exchange routes on. Headers exchanges ignore
+	// headers starting with x-, so it doesn't.
+	RetryQueueHeader = "retry-queue"
+)
+
+// Retry is where a Consumer sends the messages to be tried again: through
+// Exchange, with RetryQueueHeader set to Queue, which the exchange routes
+// back to Queue after a delay, keeping their routing key.
+type Retry struct {
+	Channel  Channel
+	Exchange string
+	Queue    string
+}
+
+// Consumer dispatches messages to a Handler by routing key.
+type Consumer struct {
+	service  string
+	retry    Retry
+	handlers map[string]Handler
+
+	mu sync.Mutex
+	// paused stops Run from taking messages; changed is closed and replaced
+	// whenever it changes, to wake Run up.
+	paused   bool
+	changed  chan struct{}
+	inFlight map[*amqp.Delivery]*inFlight
+}
+
+func NewConsumer(service string, retry Retry) *Consumer {
+	return &Consumer{
+		service:  service,
+		retry:    retry,
+		handlers: map[string]Handler{},
+		changed:  make(chan struct{}),
+		inFlight: map[*amqp.Delivery]*inFlight{},
+	}
+}
+
+// Handle registers the handler for messages with routing key.
+func (c *Consumer) Handle(routingKey string, handler Handler) {
+	c.handlers[routingKey] = handler
+}
+
+// Process runs the handler for msg in a queue.process transaction that
+// continues the trace in its headers, then settles msg by the handler's
+// result. Messages nobody handles are rejected.
+func (c *Consumer) Process(ctx context.Context, msg amqp.Delivery) {
+	metrics.TrackDelivery(&msg)
+
+	ctx = faults.WithScope(logging.WithRoutingKey(ctx, msg.RoutingKey), "routing_key", msg.RoutingKey)
+	tx := tracing.StartTransaction(ctx, "queue.process", tracing.TableCarrier(msg.Headers))
+	defer tx.Finish()
+	defer c.track(tx.Context(), &msg)()
+	tx.Origin = origin
+	tx.Source = sentry.SourceTask
+
+	tx.SetData("service", c.service)
+	tx.SetData("messaging.system", system)
+	tx.SetData("messaging.operation", "process")
+	tx.SetData("messaging.destination.name", msg.Exchange)
+	tx.SetData("messaging.destination.routing_key", msg.RoutingKey)
+	tx.SetData("messaging.message.id", msg.MessageId)
+	tx.SetData("messaging.message.body.size", len(msg.Body))
+	tx.SetData("messaging.message.retry.count", RetryCount(&msg))
+	// AMQP timestamps only have second precision, so this is as well.
+	if !msg.Timestamp.IsZero() {
+		tx.SetData("messaging.message.receive.latency", time.Since(msg.Timestamp).Milliseconds())
+	}
+
+	handler, ok := c.handlers[msg.RoutingKey]
+	err := faults.Inject(tx.Context(), faults.PointProcess, msg.RoutingKey)
+	switch {
+	case err != nil:
+		logging.Errorf(tx.Context(), "❌ Error handling %s event: %v", msg.RoutingKey, err)
+	case ok:
+		err = handler(tx.Context(), &msg)
+	default:
+		err = Reject(fmt.Errorf("❌ AMQP: No handler for routing key %q", msg.RoutingKey))
+		logging.Errorf(tx.Context(), "%v", err)
+	}
+
+	var rejected *rejection
+	switch {
+	case err == nil:
+		tx.SetData("messaging.rabbitmq.outcome", "ack")
+		err = msg.Ack(false)
+	case errors.As(err, &rejected):
+		tx.SetError(err)
+		tx.SetData("messaging.rabbitmq.outcome", "reject")
+		err = msg.Nack(false, false)
+	case redeliveries(&msg) >= MaxRedeliveries:
+		tx.SetError(err)
+		tx.SetData("messaging.rabbitmq.outcome", "reject")
+		logging.Errorf(tx.Context(), "❌ AMQP: Giving up on %s event after %d redeliveries", msg.RoutingKey, MaxRedeliveries)
+		err = msg.Nack(false, false)
+	default:
+		tx.SetError(err)
+		tx.SetData("messaging.rabbitmq.outcome", "retry")
+		err = c.redeliver(tx.Context(), &msg)
+	}
+	if err != nil {
+		logging.Errorf(tx.Context(), "❌ AMQP: Failed to settle message: %v", err)
+	}
+}
+
+// redeliver sends a copy of msg to be tried again, with RedeliveryHeader
+// counting one more attempt, and acks msg. If the copy can't be sent, msg is
+// requeued instead, uncounted.
+func (c *Consumer) redeliver(ctx context.Context, msg *amqp.Delivery) error {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers[RedeliveryHeader] = redeliveries(msg) + 1
+	headers[RetryQueueHeader] = c.retry.Queue
+
+	err := c.retry.Channel.PublishWithContext(ctx, c.retry.Exchange, msg.RoutingKey, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	})
+	if err != nil {
+		logging.Errorf(ctx, "❌ AMQP: Failed to send message to be retried, requeueing it: %v", err)
+		return msg.Nack(false, true)
+	}
+	return msg.Ack(false)
+}
+
+// redeliveries is how many times msg has been sent back to be tried again.
+func redeliveries(msg *amqp.Delivery) int64 {
+	switch count := msg.Headers[RedeliveryHeader].(type) {
+	case int64:
+		return count
+	case int32:
+		return int64(count)
+	case int:
+		return int64(count)
+	}
+	return 0
+}
+
+// Reject marks err as permanent, such as a message that can't be decoded,
+// so the message is rejected, and dead-lettered, instead of being tried
+// again.
+func Reject(err error) error {
+	return &rejection{err: err}
+}
+
+type rejection struct {
+	err error
+}
+
+func (r *rejection) Error() string {
+	return r.err.Error()
+}
+
+func (r *rejection) Unwrap() error {
+	return r.err
+}
+
+// Decode unmarshals the body of msg into event in a deserialize span. A
+// body that doesn't decode never will, so its error is a Reject.
+func Decode(ctx context.Context, msg *amqp.Delivery, event proto.Message) error {
+	span := tracing.StartSpan(ctx, "deserialize", "proto.Unmarshal")
+	defer span.Finish()
+	span.SetData("event.name", eventName(event))
+
+	if err := proto.Unmarshal(msg.Body, event); err != nil {
+		span.SetError(err)
+		return Reject(err)
+	}
+	return nil
+}
+
+// RetryCount is how many times msg was delivered before: the dead-letter
+// cycles recorded in its x-death header, or one if the broker redelivered
+// it after a requeue.
+func RetryCount(msg *amqp.Delivery) int64 {
+	var count int64
+	if deaths, ok := msg.Headers["x-death"].([]interface{}); ok {
+		for _, death := range deaths {
+			if table, ok := death.(amqp.Table); ok {
+				if n, ok := table["count"].(int64); ok {
+					count += n
+				}
+			}
+		}
+	}
+	if count == 0 && msg.Redelivered {
+		count = 1
+	}
+	return count
+}
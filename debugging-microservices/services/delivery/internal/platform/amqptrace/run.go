@@ -0,0 +1,139 @@
+package amqptrace
+
+import (
+	"context"
+	"delivery/internal/platform/logging"
+	"delivery/internal/platform/tracing"
+	"errors"
+	"sort"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Run processes the messages from msgs one at a time until ctx is done or
+// msgs is closed. A message being processed when ctx is cancelled is still
+// processed to completion; cancellation only stops Run from taking the next
+// one. While paused, Run leaves messages with the broker.
+func (c *Consumer) Run(ctx context.Context, msgs <-chan amqp.Delivery) error {
+	processCtx := context.WithoutCancel(ctx)
+
+	for {
+		paused, changed := c.state()
+		if paused {
+			select {
+			case <-ctx.Done():
+				logging.Infof(ctx, "✋ AMQP: Stopped consuming events")
+				return nil
+			case <-changed:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			logging.Infof(ctx, "✋ AMQP: Stopped consuming events")
+			return nil
+		case <-changed:
+		case msg, ok := <-msgs:
+			if !ok {
+				return errors.New("❌ AMQP: Delivery channel closed")
+			}
+			c.Process(processCtx, msg)
+		}
+	}
+}
+
+// Pause stops Run from taking messages once it's done with the current one.
+func (c *Consumer) Pause() {
+	c.setPaused(true)
+	logging.Warnf(context.Background(), "⏸️ AMQP: Consuming paused")
+}
+
+// Resume undoes Pause.
+func (c *Consumer) Resume() {
+	c.setPaused(false)
+	logging.Infof(context.Background(), "▶️ AMQP: Consuming resumed")
+}
+
+func (c *Consumer) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused == paused {
+		return
+	}
+	c.paused = paused
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Consumer) state() (bool, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused, c.changed
+}
+
+// inFlight is a message being processed.
+type inFlight struct {
+	ctx        context.Context
+	msg        *amqp.Delivery
+	receivedAt time.Time
+}
+
+// track records msg as in flight until the returned func is called.
+func (c *Consumer) track(ctx context.Context, msg *amqp.Delivery) func() {
+	c.mu.Lock()
+	c.inFlight[msg] = &inFlight{ctx: ctx, msg: msg, receivedAt: time.Now()}
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		delete(c.inFlight, msg)
+		c.mu.Unlock()
+	}
+}
+
+// State is a snapshot of a Consumer.
+type State struct {
+	Paused   bool       `json:"paused"`
+	InFlight []InFlight `json:"in_flight"`
+}
+
+// InFlight describes a message being processed.
+type InFlight struct {
+	RoutingKey  string    `json:"routing_key"`
+	MessageID   string    `json:"message_id"`
+	OrderID     *int64    `json:"order_id,omitempty"`
+	TraceID     string    `json:"trace_id,omitempty"`
+	Redelivered bool      `json:"redelivered"`
+	ReceivedAt  time.Time `json:"received_at"`
+	Age         string    `json:"age"`
+}
+
+// State returns whether c is paused and the messages it's processing,
+// oldest first.
+func (c *Consumer) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := State{Paused: c.paused, InFlight: []InFlight{}}
+	for _, entry := range c.inFlight {
+		message := InFlight{
+			RoutingKey:  entry.msg.RoutingKey,
+			MessageID:   entry.msg.MessageId,
+			Redelivered: entry.msg.Redelivered,
+			ReceivedAt:  entry.receivedAt,
+			Age:         time.Since(entry.receivedAt).Round(time.Millisecond).String(),
+		}
+		if orderID, ok := logging.OrderID(entry.ctx); ok {
+			message.OrderID = &orderID
+		}
+		message.TraceID, _ = tracing.IDs(entry.ctx)
+		state.InFlight = append(state.InFlight, message)
+	}
+	sort.Slice(state.InFlight, func(i, j int) bool {
+		return state.InFlight[i].ReceivedAt.Before(state.InFlight[j].ReceivedAt)
+	})
+
+	return state
+}
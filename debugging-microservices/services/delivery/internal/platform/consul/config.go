@@ -0,0 +1,140 @@
+package consul
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes how a service instance registers with Consul.
+type Config struct {
+	// AgentAddress is the Consul agent's HTTP address (CONSUL_HTTP_ADDR).
+	AgentAddress string
+
+	// Name is the service name other services discover (CONSUL_SERVICE_NAME).
+	Name string
+	// ID identifies this instance (CONSUL_SERVICE_ID). It defaults to the
+	// service name and hostname so a restarted container re-registers under
+	// the same id instead of leaving a critical duplicate behind.
+	ID string
+	// Address and Port are where the instance can be reached
+	// (CONSUL_SERVICE_ADDRESS, defaulting to the first non-loopback IPv4
+	// address, and CONSUL_SERVICE_PORT).
+	Address string
+	Port    int
+	// Tags are CONSUL_SERVICE_TAGS, comma separated. The service name and
+	// "microservice" are always included.
+	Tags []string
+	// Meta is CONSUL_SERVICE_META as comma separated key=value pairs, on top
+	// of the version, revision and environment of the build.
+	Meta map[string]string
+
+	// CheckHTTP is the path, or full URL, Consul polls for readiness
+	// (CONSUL_SERVICE_CHECK_HTTP).
+	CheckHTTP string
+	// CheckInterval and CheckTimeout control the HTTP check
+	// (CONSUL_SERVICE_CHECK_INTERVAL, CONSUL_SERVICE_CHECK_TIMEOUT).
+	CheckInterval time.Duration
+	CheckTimeout  time.Duration
+	// CheckTTL switches to a TTL check the service keeps updated itself
+	// (CONSUL_SERVICE_CHECK_TTL). Zero means an HTTP check.
+	CheckTTL time.Duration
+	// DeregisterAfter is how long a critical instance stays registered
+	// (CONSUL_SERVICE_DEREGISTER_AFTER).
+	DeregisterAfter time.Duration
+}
+
+// ConfigFromEnv reads the registration settings from the environment.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		AgentAddress: os.Getenv("CONSUL_HTTP_ADDR"),
+		Name:         os.Getenv("CONSUL_SERVICE_NAME"),
+		ID:           os.Getenv("CONSUL_SERVICE_ID"),
+		Address:      getEnv("CONSUL_SERVICE_ADDRESS", getInternalIP()),
+		CheckHTTP:    getEnv("CONSUL_SERVICE_CHECK_HTTP", "/health/ready"),
+	}
+
+	if config.Name == "" {
+		return Config{}, fmt.Errorf("❌ CONSUL_SERVICE_NAME is required")
+	}
+
+	port, err := strconv.Atoi(os.Getenv("CONSUL_SERVICE_PORT"))
+	if err != nil {
+		return Config{}, fmt.Errorf("❌ Failed to convert service port to int: %w", err)
+	}
+	config.Port = port
+
+	if config.ID == "" {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = config.Address
+		}
+		config.ID = fmt.Sprintf("%s-%s-%d", config.Name, hostname, config.Port)
+	}
+
+	config.Tags = []string{config.Name, "microservice"}
+	for _, tag := range strings.Split(os.Getenv("CONSUL_SERVICE_TAGS"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" && !contains(config.Tags, tag) {
+			config.Tags = append(config.Tags, tag)
+		}
+	}
+
+	config.Meta = map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("CONSUL_SERVICE_META"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return Config{}, fmt.Errorf("❌ Invalid CONSUL_SERVICE_META entry %q, expected key=value", pair)
+		}
+		config.Meta[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	durations := []struct {
+		key      string
+		fallback string
+		target   *time.Duration
+	}{
+		{"CONSUL_SERVICE_CHECK_INTERVAL", "10s", &config.CheckInterval},
+		{"CONSUL_SERVICE_CHECK_TIMEOUT", "5s", &config.CheckTimeout},
+		{"CONSUL_SERVICE_CHECK_TTL", "0", &config.CheckTTL},
+		{"CONSUL_SERVICE_DEREGISTER_AFTER", "30s", &config.DeregisterAfter},
+	}
+	for _, d := range durations {
+		value, err := time.ParseDuration(getEnv(d.key, d.fallback))
+		if err != nil || value < 0 {
+			return Config{}, fmt.Errorf("❌ Invalid %s %q", d.key, os.Getenv(d.key))
+		}
+		*d.target = value
+	}
+
+	return config, nil
+}
+
+// checkURL resolves CheckHTTP against the instance's own address. Compose
+// has historically set it to a bare path such as "health".
+func (c Config) checkURL() string {
+	if strings.HasPrefix(c.CheckHTTP, "http://") || strings.HasPrefix(c.CheckHTTP, "https://") {
+		return c.CheckHTTP
+	}
+	return fmt.Sprintf("http://%s:%d/%s", c.Address, c.Port, strings.TrimPrefix(c.CheckHTTP, "/"))
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
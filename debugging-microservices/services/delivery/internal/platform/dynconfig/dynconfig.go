@@ -0,0 +1,288 @@
+package dynconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const retryInterval = 5 * time.Second
+
+// Validator is implemented by settings structs that need more than their
+// fields to parse, e.g. a rate between 0 and 1.
+type Validator interface {
+	Validate() error
+}
+
+// Watcher holds the current settings of a service and keeps them up to date
+// with Consul KV.
+//
+// T is a struct whose fields carry a `key` tag naming the KV key under
+// config/<service>/, and optionally `env` and `default` tags for when the
+// key isn't set. Supported field types are string, bool, int, float64 and
+// time.Duration.
+type Watcher[T any] struct {
+	source Source
+	prefix string
+	index  uint64
+
+	current atomic.Pointer[T]
+
+	mu        sync.Mutex
+	listeners []func(old, new *T)
+}
+
+// Load reads the settings of a service. If the source can't be reached the
+// settings come from env and defaults, and Watch picks up the KV values once
+// it can. An invalid value is an error, since there is nothing sensible to
+// fall back to at startup.
+func Load[T any](ctx context.Context, source Source, service string) (*Watcher[T], error) {
+	w := &Watcher[T]{
+		source: source,
+		prefix: "config/" + service + "/",
+	}
+
+	values, index, err := source.List(ctx, w.prefix, 0)
+	if err != nil {
+		log.Printf("❌ Config: Failed to read %s, using env and defaults: %v", w.prefix, err)
+		values = nil
+	}
+	w.index = index
+
+	settings, err := decode[T](values)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Invalid config under %s: %w", w.prefix, err)
+	}
+	w.current.Store(settings)
+
+	log.Printf("✅ Config: Loaded %d key(s) from %s", len(values), w.prefix)
+	return w, nil
+}
+
+// Current returns the settings in effect. Callers should read it once per
+// unit of work rather than keep it, so changes apply to the next one.
+func (w *Watcher[T]) Current() *T {
+	return w.current.Load()
+}
+
+// OnChange registers fn to be called after the settings change.
+func (w *Watcher[T]) OnChange(fn func(old, new *T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Values returns the settings in effect by KV key, formatted as they would
+// be written there.
+func (w *Watcher[T]) Values() map[string]string {
+	current := reflect.ValueOf(w.Current()).Elem()
+
+	values := map[string]string{}
+	for i := 0; i < current.NumField(); i++ {
+		if key := current.Type().Field(i).Tag.Get("key"); key != "" {
+			values[key] = fmt.Sprint(current.Field(i).Interface())
+		}
+	}
+	return values
+}
+
+// Watch applies changes to the KV keys until ctx is done. A change that
+// doesn't parse or validate is logged and ignored, keeping the previous
+// settings.
+func (w *Watcher[T]) Watch(ctx context.Context) error {
+	for {
+		values, index, err := w.source.List(ctx, w.prefix, w.index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			log.Printf("❌ Config: Failed to watch %s: %v", w.prefix, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		if index == w.index {
+			continue
+		}
+		// The index can go backwards, e.g. after a Consul restart; start
+		// over rather than wait for an index that won't come.
+		if index < w.index {
+			index = 0
+		}
+		w.index = index
+
+		w.apply(values)
+	}
+}
+
+func (w *Watcher[T]) apply(values map[string]string) {
+	next, err := decode[T](values)
+	if err != nil {
+		log.Printf("❌ Config: Ignoring invalid change under %s: %v", w.prefix, err)
+		sentry.AddBreadcrumb(&sentry.Breadcrumb{
+			Type:     "error",
+			Category: "config",
+			Message:  fmt.Sprintf("Ignored invalid config under %s: %v", w.prefix, err),
+			Level:    sentry.LevelWarning,
+		})
+		return
+	}
+
+	old := w.current.Load()
+	changes := diff(old, next)
+	if len(changes) == 0 {
+		return
+	}
+
+	w.current.Store(next)
+
+	for _, change := range changes {
+		log.Printf("♻️ Config: %s%s changed from %v to %v", w.prefix, change.key, change.old, change.new)
+		sentry.AddBreadcrumb(&sentry.Breadcrumb{
+			Category: "config",
+			Message:  fmt.Sprintf("%s%s changed", w.prefix, change.key),
+			Data: map[string]interface{}{
+				"key": w.prefix + change.key,
+				"old": fmt.Sprint(change.old),
+				"new": fmt.Sprint(change.new),
+			},
+			Level: sentry.LevelInfo,
+		})
+	}
+
+	w.mu.Lock()
+	listeners := w.listeners
+	w.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(old, next)
+	}
+}
+
+type change struct {
+	key      string
+	old, new interface{}
+}
+
+func diff[T any](old, new *T) []change {
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+
+	var changes []change
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		key := field.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changes = append(changes, change{
+				key: key,
+				old: oldValue.Field(i).Interface(),
+				new: newValue.Field(i).Interface(),
+			})
+		}
+	}
+
+	return changes
+}
+
+// decode builds the settings from the KV values, then env, then defaults.
+func decode[T any](values map[string]string) (*T, error) {
+	settings := new(T)
+	value := reflect.ValueOf(settings).Elem()
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("settings must be a struct, got %s", value.Kind())
+	}
+
+	var errs []error
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := field.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+
+		raw, source, ok := values[key], key, true
+		if _, found := values[key]; !found {
+			raw, ok = field.Tag.Lookup("default")
+			source = "default"
+			if env := field.Tag.Get("env"); env != "" {
+				if fromEnv := os.Getenv(env); fromEnv != "" {
+					raw, source, ok = fromEnv, env, true
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		if err := set(value.Field(i), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s (from %s): %w", key, source, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if validator, ok := any(settings).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return settings, nil
+}
+
+func set(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package dynconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+type testSettings struct {
+	Rate    float64       `key:"rate" default:"0.5"`
+	Enabled bool          `key:"enabled" default:"false"`
+	Timeout time.Duration `key:"timeout" default:"1s"`
+}
+
+func (s *testSettings) Validate() error {
+	if s.Rate < 0 || s.Rate > 1 {
+		return errors.New("rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// watch loads the settings from source and watches them until the test
+// ends. Changes are sent on the returned channel.
+func watch(t *testing.T, source *MemorySource) (*Watcher[testSettings], <-chan *testSettings) {
+	t.Helper()
+
+	watcher, err := Load[testSettings](context.Background(), source, "test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	changes := make(chan *testSettings, 10)
+	watcher.OnChange(func(old, new *testSettings) {
+		changes <- new
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.Watch(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	})
+
+	return watcher, changes
+}
+
+func waitChange(t *testing.T, changes <-chan *testSettings) *testSettings {
+	t.Helper()
+	select {
+	case settings := <-changes:
+		return settings
+	case <-time.After(time.Second):
+		t.Fatal("no change")
+		return nil
+	}
+}
+
+func expectNoChange(t *testing.T, changes <-chan *testSettings) {
+	t.Helper()
+	select {
+	case settings := <-changes:
+		t.Fatalf("unexpected change to %+v", *settings)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLoad(t *testing.T) {
+	source := NewMemorySource(map[string]string{
+		"config/test/rate":  "0.25",
+		"config/other/rate": "0.75",
+	})
+
+	watcher, err := Load[testSettings](context.Background(), source, "test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := testSettings{Rate: 0.25, Enabled: false, Timeout: time.Second}
+	if got := *watcher.Current(); got != want {
+		t.Errorf("Current() = %+v, want %+v", got, want)
+	}
+
+	source.Set("config/test/rate", "2")
+	if _, err := Load[testSettings](context.Background(), source, "test"); err == nil {
+		t.Error("Load succeeded with an invalid rate")
+	}
+}
+
+func TestWatchReloads(t *testing.T) {
+	source := NewMemorySource(nil)
+	watcher, changes := watch(t, source)
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  testSettings
+	}{
+		{"set", "rate", "0.25", testSettings{Rate: 0.25, Timeout: time.Second}},
+		{"set another", "enabled", "true", testSettings{Rate: 0.25, Enabled: true, Timeout: time.Second}},
+		{"change", "rate", "0.75", testSettings{Rate: 0.75, Enabled: true, Timeout: time.Second}},
+		{"delete", "rate", "", testSettings{Rate: 0.5, Enabled: true, Timeout: time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.value == "" {
+				source.Delete("config/test/" + tt.key)
+			} else {
+				source.Set("config/test/"+tt.key, tt.value)
+			}
+
+			if got := *waitChange(t, changes); got != tt.want {
+				t.Errorf("OnChange got %+v, want %+v", got, tt.want)
+			}
+			if got := *watcher.Current(); got != tt.want {
+				t.Errorf("Current() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchNotifiesOncePerChange(t *testing.T) {
+	source := NewMemorySource(map[string]string{"config/test/rate": "0.25"})
+	_, changes := watch(t, source)
+
+	source.Set("config/test/rate", "0.75")
+	if got := waitChange(t, changes).Rate; got != 0.75 {
+		t.Fatalf("rate = %v, want 0.75", got)
+	}
+
+	// Writing the same value, the default or another service's key changes
+	// the index but not the settings.
+	source.Set("config/test/rate", "0.75")
+	source.Set("config/test/enabled", "false")
+	source.Set("config/other/rate", "0.1")
+	expectNoChange(t, changes)
+}
+
+func TestWatchKeepsLastGoodConfig(t *testing.T) {
+	source := NewMemorySource(map[string]string{"config/test/rate": "0.25"})
+	watcher, changes := watch(t, source)
+
+	tests := []struct {
+		name    string
+		key     string
+		invalid string
+		valid   string
+	}{
+		{"unparsable", "rate", "often", "0.3"},
+		{"invalid", "rate", "2", "0.4"},
+		{"wrong type", "timeout", "10", "10s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := *watcher.Current()
+
+			source.Set("config/test/"+tt.key, tt.invalid)
+			expectNoChange(t, changes)
+			if got := *watcher.Current(); got != last {
+				t.Errorf("Current() = %+v after an invalid update, want %+v", got, last)
+			}
+
+			// Fixing the key applies again.
+			source.Set("config/test/"+tt.key, tt.valid)
+			if got := *waitChange(t, changes); got == last {
+				t.Errorf("fixing %s didn't change the settings", tt.key)
+			}
+		})
+	}
+}
+
+func TestWatchRecordsChanges(t *testing.T) {
+	var mu sync.Mutex
+	var breadcrumbs []*sentry.Breadcrumb
+	if err := sentry.Init(sentry.ClientOptions{
+		BeforeBreadcrumb: func(breadcrumb *sentry.Breadcrumb, hint *sentry.BreadcrumbHint) *sentry.Breadcrumb {
+			mu.Lock()
+			defer mu.Unlock()
+			breadcrumbs = append(breadcrumbs, breadcrumb)
+			return breadcrumb
+		},
+	}); err != nil {
+		t.Fatalf("sentry.Init: %v", err)
+	}
+	t.Cleanup(func() { sentry.Init(sentry.ClientOptions{}) })
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	source := NewMemorySource(map[string]string{"config/test/rate": "0.25"})
+	_, changes := watch(t, source)
+
+	source.Set("config/test/rate", "0.75")
+	waitChange(t, changes)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(breadcrumbs) != 1 {
+		t.Fatalf("got %d breadcrumbs, want 1", len(breadcrumbs))
+	}
+	breadcrumb := breadcrumbs[0]
+	if breadcrumb.Category != "config" || breadcrumb.Message != "config/test/rate changed" {
+		t.Errorf("breadcrumb = %s %q", breadcrumb.Category, breadcrumb.Message)
+	}
+	if breadcrumb.Data["old"] != "0.25" || breadcrumb.Data["new"] != "0.75" {
+		t.Errorf("breadcrumb data = %v", breadcrumb.Data)
+	}
+
+	if !strings.Contains(logs.String(), "config/test/rate changed from 0.25 to 0.75") {
+		t.Errorf("change not logged:\n%s", logs.String())
+	}
+}
+
+func TestWatchStops(t *testing.T) {
+	source := NewMemorySource(nil)
+	watcher, err := Load[testSettings](context.Background(), source, "test")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- watcher.Watch(ctx) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch didn't return after its context was done")
+	}
+
+	source.Set("config/test/rate", "0.75")
+	if got := watcher.Current().Rate; got != 0.5 {
+		t.Errorf("rate = %v after stopping, want 0.5", got)
+	}
+}
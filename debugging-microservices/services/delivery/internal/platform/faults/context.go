@@ -0,0 +1,60 @@
+package faults
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type scopeKey struct{}
+
+// scope is shared by every context derived from the one it was added to,
+// so a customer id found partway through handling a request also scopes the
+// calls made with contexts that were handed on before.
+type scope struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// WithScope returns a context whose calls match rules scoped to key and
+// value, e.g. "product_id" and 3.
+func WithScope(ctx context.Context, key string, value interface{}) context.Context {
+	ctx = withEmptyScope(ctx)
+	SetScope(ctx, key, value)
+	return ctx
+}
+
+// withEmptyScope returns a context with a scope of its own for SetScope to
+// add to, holding the values of the scope ctx carries.
+func withEmptyScope(ctx context.Context) context.Context {
+	s := &scope{values: map[string]string{}}
+	if parent, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		parent.mu.Lock()
+		for k, v := range parent.values {
+			s.values[k] = v
+		}
+		parent.mu.Unlock()
+	}
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// SetScope adds key and value to the scope ctx already carries, for when
+// it's only known once ctx has been handed on, such as after decoding a
+// request. It does nothing if ctx carries no scope.
+func SetScope(ctx context.Context, key string, value interface{}) {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		s.values[key] = fmt.Sprint(value)
+		s.mu.Unlock()
+	}
+}
+
+func scopeValue(ctx context.Context, key string) string {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
@@ -0,0 +1,138 @@
+package faults
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// WrapHTTP injects faults for the handler's route before it runs. An error
+// fault responds with 500 without calling next.
+func WrapHTTP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := withEmptyScope(r.Context())
+		if err := Inject(ctx, PointHTTP, r.Pattern); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Handler serves the rules under /admin/faults:
+//
+//	GET    /admin/faults                 lists the rules
+//	PUT    /admin/faults                 replaces them with a JSON array
+//	DELETE /admin/faults                 removes them all
+//	PUT    /admin/faults/{name}          adds or replaces one rule
+//	DELETE /admin/faults/{name}          removes one rule
+//	POST   /admin/faults/{name}/enable   turns a rule on
+//	POST   /admin/faults/{name}/disable  turns a rule off
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/faults", handleList)
+	mux.HandleFunc("PUT /admin/faults", handleReplace)
+	mux.HandleFunc("DELETE /admin/faults", handleClear)
+	mux.HandleFunc("PUT /admin/faults/{name}", handlePut)
+	mux.HandleFunc("DELETE /admin/faults/{name}", handleDelete)
+	mux.HandleFunc("POST /admin/faults/{name}/enable", handleToggle(false))
+	mux.HandleFunc("POST /admin/faults/{name}/disable", handleToggle(true))
+	return mux
+}
+
+func handleList(w http.ResponseWriter, r *http.Request) {
+	writeRules(w)
+}
+
+func handleReplace(w http.ResponseWriter, r *http.Request) {
+	var newRules []Rule
+	if err := json.NewDecoder(r.Body).Decode(&newRules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := SetRules(newRules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeRules(w)
+}
+
+func handleClear(w http.ResponseWriter, r *http.Request) {
+	SetRules(nil)
+	writeRules(w)
+}
+
+func handlePut(w http.ResponseWriter, r *http.Request) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.Name = r.PathValue("name")
+
+	update(w, func(current []Rule) ([]Rule, error) {
+		for i := range current {
+			if current[i].Name == rule.Name {
+				current[i] = rule
+				return current, nil
+			}
+		}
+		return append(current, rule), nil
+	})
+}
+
+func handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	update(w, func(current []Rule) ([]Rule, error) {
+		for i := range current {
+			if current[i].Name == name {
+				return append(current[:i], current[i+1:]...), nil
+			}
+		}
+		return nil, errNotFound
+	})
+}
+
+func handleToggle(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		update(w, func(current []Rule) ([]Rule, error) {
+			for i := range current {
+				if current[i].Name == name {
+					current[i].Disabled = disabled
+					return current, nil
+				}
+			}
+			return nil, errNotFound
+		})
+	}
+}
+
+var errNotFound = errors.New("❌ No such fault rule")
+
+// update applies change to a copy of the current rules. Concurrent admin
+// requests may race; the last one wins, which is fine for a demo switch.
+func update(w http.ResponseWriter, change func([]Rule) ([]Rule, error)) {
+	newRules, err := change(Rules())
+	if errors.Is(err, errNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = SetRules(newRules)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeRules(w)
+}
+
+func writeRules(w http.ResponseWriter) {
+	current := Rules()
+	if current == nil {
+		current = []Rule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
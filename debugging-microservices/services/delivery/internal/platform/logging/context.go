@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"delivery/internal/platform/tracing"
+	"log/slog"
+	"sync"
+)
+
+type fieldsKey struct{}
+
+// fields are shared by every context derived from the one they were added
+// to, so an order id found partway through processing a message shows up in
+// the logs of the spans that were already started.
+type fields struct {
+	mu         sync.Mutex
+	orderID    int64
+	hasOrderID bool
+	routingKey string
+}
+
+// WithRoutingKey returns a context whose logs carry the routing key of the
+// message being processed.
+func WithRoutingKey(ctx context.Context, routingKey string) context.Context {
+	f := copyFields(ctx)
+	f.routingKey = routingKey
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// WithOrderID returns a context whose logs carry the order id.
+func WithOrderID[T ~int | ~int32 | ~int64](ctx context.Context, orderID T) context.Context {
+	f := copyFields(ctx)
+	f.orderID, f.hasOrderID = int64(orderID), true
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// SetOrderID adds the order id to the fields ctx already carries, for when
+// it's only known once ctx has been handed on, such as after decoding a
+// message. It does nothing if ctx carries no fields.
+func SetOrderID[T ~int | ~int32 | ~int64](ctx context.Context, orderID T) {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.orderID, f.hasOrderID = int64(orderID), true
+		f.mu.Unlock()
+	}
+}
+
+// OrderID returns the order id ctx's logs carry, if any.
+func OrderID(ctx context.Context) (int64, bool) {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return 0, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.orderID, f.hasOrderID
+}
+
+func copyFields(ctx context.Context) *fields {
+	f := &fields{}
+	if parent, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		parent.mu.Lock()
+		f.orderID, f.hasOrderID, f.routingKey = parent.orderID, parent.hasOrderID, parent.routingKey
+		parent.mu.Unlock()
+	}
+	return f
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+
+	if traceID, spanID := tracing.IDs(ctx); traceID != "" {
+		attrs = append(attrs, slog.String("trace_id", traceID), slog.String("span_id", spanID))
+	}
+
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		if f.hasOrderID {
+			attrs = append(attrs, slog.Int64("order_id", f.orderID))
+		}
+		if f.routingKey != "" {
+			attrs = append(attrs, slog.String("routing_key", f.routingKey))
+		}
+		f.mu.Unlock()
+	}
+
+	return attrs
+}
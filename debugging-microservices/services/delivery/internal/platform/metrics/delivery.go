@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TrackDelivery counts a received message and records how it's settled. It
+// wraps the delivery's acknowledger, so the existing Ack and Nack calls are
+// measured without changes: the outcome and the time from receipt to
+// settlement are recorded once, whichever is called first.
+func TrackDelivery(msg *amqp.Delivery) {
+	labels := prometheus.Labels{
+		"messaging_system":                  messagingSystem,
+		"messaging_destination_name":        msg.Exchange,
+		"messaging_destination_routing_key": msg.RoutingKey,
+	}
+	messagesConsumed.With(labels).Inc()
+
+	if msg.Acknowledger == nil {
+		return
+	}
+	msg.Acknowledger = &trackedAcknowledger{
+		Acknowledger: msg.Acknowledger,
+		labels:       labels,
+		received:     time.Now(),
+	}
+}
+
+type trackedAcknowledger struct {
+	amqp.Acknowledger
+	labels   prometheus.Labels
+	received time.Time
+	once     sync.Once
+}
+
+func (a *trackedAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.settle("ack")
+	return a.Acknowledger.Ack(tag, multiple)
+}
+
+func (a *trackedAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		a.settle("requeue")
+	} else {
+		a.settle("nack")
+	}
+	return a.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (a *trackedAcknowledger) Reject(tag uint64, requeue bool) error {
+	if requeue {
+		a.settle("requeue")
+	} else {
+		a.settle("nack")
+	}
+	return a.Acknowledger.Reject(tag, requeue)
+}
+
+func (a *trackedAcknowledger) settle(outcome string) {
+	a.once.Do(func() {
+		labels := prometheus.Labels{"outcome": outcome}
+		for key, value := range a.labels {
+			labels[key] = value
+		}
+		messagesSettled.With(labels).Inc()
+		processDuration.With(labels).Observe(time.Since(a.received).Seconds())
+	})
+}
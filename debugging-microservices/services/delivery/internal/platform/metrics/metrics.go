@@ -0,0 +1,118 @@
+// Package metrics exposes Prometheus metrics for messaging and database
+// calls. Label names follow the span data the code already sets, with dots
+// turned into underscores, so a metric and its spans can be matched up:
+// messaging.destination.routing_key becomes messaging_destination_routing_key.
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const messagingSystem = "rabbitmq"
+
+var messagingLabels = []string{
+	"messaging_system",
+	"messaging_destination_name",
+	"messaging_destination_routing_key",
+}
+
+var (
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "messaging_messages_consumed_total",
+		Help: "Messages received from the broker.",
+	}, messagingLabels)
+
+	messagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "messaging_messages_published_total",
+		Help: "Messages the broker accepted for publishing.",
+	}, messagingLabels)
+
+	publishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "messaging_publish_errors_total",
+		Help: "Messages that failed to publish.",
+	}, messagingLabels)
+
+	messagesSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "messaging_messages_settled_total",
+		Help: "Received messages by outcome: ack, nack (dropped or dead-lettered) or requeue.",
+	}, append(messagingLabels, "outcome"))
+
+	processDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "messaging_process_duration_seconds",
+		Help:    "Time from receiving a message to settling it, by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, append(messagingLabels, "outcome"))
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_client_operation_duration_seconds",
+		Help:    "Duration of database queries.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"db_system", "db_name", "db_operation", "db_sql_table"})
+)
+
+// Handler serves the metrics for Prometheus to scrape.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// MessagePublished counts a publish to exchange with routing key, or a
+// failure to publish when err is set.
+func MessagePublished(exchange, routingKey string, err error) {
+	labels := prometheus.Labels{
+		"messaging_system":                  messagingSystem,
+		"messaging_destination_name":        exchange,
+		"messaging_destination_routing_key": routingKey,
+	}
+	if err != nil {
+		publishErrors.With(labels).Inc()
+		return
+	}
+	messagesPublished.With(labels).Inc()
+}
+
+// ConnectionState reports whether the broker connection is open. connected
+// is called on every scrape.
+func ConnectionState(connected func() bool) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "messaging_connection_up",
+		Help:        "Whether the connection to the broker is open.",
+		ConstLabels: prometheus.Labels{"messaging_system": messagingSystem},
+	}, func() float64 {
+		if connected() {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// ObserveSpan records the duration of finished database spans, using their
+// db.* data as labels. Other spans are ignored.
+func ObserveSpan(span *sentry.Span) {
+	if !strings.HasPrefix(span.Op, "db") {
+		return
+	}
+
+	end := span.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	queryDuration.With(prometheus.Labels{
+		"db_system":    dataString(span.Data, "db.system"),
+		"db_name":      dataString(span.Data, "db.name"),
+		"db_operation": dataString(span.Data, "db.operation"),
+		"db_sql_table": dataString(span.Data, "db.sql.table"),
+	}).Observe(end.Sub(span.StartTime).Seconds())
+}
+
+func dataString(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return value
+}
@@ -0,0 +1,142 @@
+package telemetry
+
+import (
+	"delivery/internal/platform/buildinfo"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Options configures Sentry for a service.
+type Options struct {
+	// DSN is where events are sent. Without one Sentry runs with a no-op
+	// transport, so the service works offline.
+	DSN         string
+	Environment string
+	Release     string
+	// TracesSampleRate is the share of transactions sent, from 0 to 1.
+	TracesSampleRate float64
+	// SampleRate, when set, is consulted for every transaction instead of
+	// TracesSampleRate, so the rate can change at runtime.
+	SampleRate func() float64
+	// IgnorePaths are URL path prefixes whose transactions are never sent,
+	// such as health checks.
+	IgnorePaths []string
+	Debug       bool
+}
+
+// OptionsFromEnv reads SENTRY_DSN, SENTRY_ENVIRONMENT (or GO_ENV),
+// SENTRY_RELEASE, SENTRY_TRACES_SAMPLE_RATE, SENTRY_IGNORE_PATHS (comma
+// separated, "/health" by default) and SENTRY_DEBUG. The release defaults to
+// <service>@<version> from the build info.
+func OptionsFromEnv(service string) (Options, error) {
+	options := Options{
+		DSN:              os.Getenv("SENTRY_DSN"),
+		Environment:      getEnv("SENTRY_ENVIRONMENT", getEnv("GO_ENV", "development")),
+		Release:          getEnv("SENTRY_RELEASE", service+"@"+buildinfo.Read().Version),
+		TracesSampleRate: 1.0,
+		IgnorePaths:      splitList(getEnv("SENTRY_IGNORE_PATHS", "/health")),
+	}
+
+	if value := os.Getenv("SENTRY_TRACES_SAMPLE_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return Options{}, fmt.Errorf("❌ Invalid SENTRY_TRACES_SAMPLE_RATE %q, expected a value between 0 and 1", value)
+		}
+		options.TracesSampleRate = rate
+	}
+
+	if value := os.Getenv("SENTRY_DEBUG"); value != "" {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("❌ Invalid SENTRY_DEBUG: %w", err)
+		}
+		options.Debug = debug
+	}
+
+	return options, nil
+}
+
+// RegisterFlags lets command-line flags override the options, which should
+// already hold their env values as defaults.
+func (o *Options) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.DSN, "sentry-dsn", o.DSN, "Sentry DSN; empty disables sending events")
+	flags.StringVar(&o.Environment, "sentry-environment", o.Environment, "Sentry environment")
+	flags.StringVar(&o.Release, "sentry-release", o.Release, "Sentry release")
+	flags.Float64Var(&o.TracesSampleRate, "sentry-traces-sample-rate", o.TracesSampleRate, "share of transactions sent to Sentry, from 0 to 1")
+	flags.Func("sentry-ignore-paths", "comma separated URL path prefixes never traced (default \""+strings.Join(o.IgnorePaths, ",")+"\")", func(value string) error {
+		o.IgnorePaths = splitList(value)
+		return nil
+	})
+	flags.BoolVar(&o.Debug, "sentry-debug", o.Debug, "log Sentry SDK debug output")
+}
+
+// Init sets up the Sentry SDK.
+func Init(options Options) error {
+	if options.DSN == "" {
+		log.Println("🚫 Sentry: No DSN set, events and traces won't be sent")
+	}
+
+	sampleRate := options.SampleRate
+	if sampleRate == nil {
+		sampleRate = func() float64 { return options.TracesSampleRate }
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              options.DSN,
+		Environment:      options.Environment,
+		Release:          options.Release,
+		Debug:            options.Debug,
+		AttachStacktrace: true,
+		EnableTracing:    true,
+		TracesSampleRate: options.TracesSampleRate,
+		TracesSampler: sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
+			if ignored(ctx.Span.Name, options.IgnorePaths) {
+				return 0.0
+			}
+			return sampleRate()
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("❌ Sentry initialization failed: %w", err)
+	}
+
+	log.Printf("✅ Sentry: Initialized release %s in %s", options.Release, options.Environment)
+	return nil
+}
+
+// ignored reports whether a transaction, named "<METHOD> <path>" by the HTTP
+// middleware, is for one of the ignored paths.
+func ignored(name string, paths []string) bool {
+	if _, path, ok := strings.Cut(name, " "); ok {
+		name = path
+	}
+	for _, prefix := range paths {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
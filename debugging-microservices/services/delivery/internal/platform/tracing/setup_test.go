@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"delivery/internal/platform/tracing/otlpmem"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// noopTransport drops events, so Sentry spans are recorded without sending
+// anything.
+type noopTransport struct{}
+
+func (noopTransport) Configure(sentry.ClientOptions)        {}
+func (noopTransport) SendEvent(*sentry.Event)               {}
+func (noopTransport) Flush(time.Duration) bool              { return true }
+func (noopTransport) FlushWithContext(context.Context) bool { return true }
+func (noopTransport) Close()                                {}
+
+func TestInitExportsSpans(t *testing.T) {
+	const remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const remoteSpanID = "00f067aa0ba902b7"
+
+	tests := []struct {
+		name    string
+		carrier propagation.MapCarrier
+		// parent is the span the transaction continues, empty for a new trace.
+		traceID, parent string
+	}{
+		{"new trace", propagation.MapCarrier{}, "", ""},
+		{
+			"continued trace",
+			propagation.MapCarrier{"traceparent": fmt.Sprintf("00-%s-%s-01", remoteTraceID, remoteSpanID)},
+			remoteTraceID, remoteSpanID,
+		},
+	}
+
+	// Baggage needs a client with a DSN to carry the trace's sampling context.
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              "https://public@sentry.example.com/1",
+		Transport:        noopTransport{},
+		EnableTracing:    true,
+		TracesSampleRate: 1,
+	})
+	if err != nil {
+		t.Fatalf("sentry.Init: %v", err)
+	}
+	t.Cleanup(func() { sentry.Init(sentry.ClientOptions{}) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := otlpmem.NewCollector()
+			defer collector.Close()
+
+			shutdown, err := Init(context.Background(), Options{
+				ServiceName:  "delivery",
+				OTLPEndpoint: collector.Endpoint(),
+				Insecure:     true,
+			})
+			if err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+
+			transaction := StartTransaction(context.Background(), "queue.process", tt.carrier)
+			child := StartSpan(transaction.Context(), "db.sql.query", "SELECT 1")
+
+			headers := propagation.MapCarrier{}
+			Inject(child.Context(), headers)
+			traceID, spanID := IDs(child.Context())
+
+			child.Finish()
+			transaction.Finish()
+
+			if err := shutdown(context.Background()); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+
+			spans := map[string]otlpmem.Span{}
+			for _, span := range collector.Spans() {
+				spans[span.Name] = span
+			}
+			if len(spans) != 2 {
+				t.Fatalf("exported %d spans, want 2: %+v", len(spans), collector.Spans())
+			}
+
+			root, ok := spans["queue.process"]
+			if !ok {
+				t.Fatalf("transaction not exported: %+v", spans)
+			}
+			query, ok := spans["SELECT 1"]
+			if !ok {
+				t.Fatalf("child span not exported: %+v", spans)
+			}
+
+			if tt.traceID != "" && root.TraceID != tt.traceID {
+				t.Errorf("transaction trace id = %s, want %s", root.TraceID, tt.traceID)
+			}
+			if root.ParentSpanID != tt.parent {
+				t.Errorf("transaction parent = %q, want %q", root.ParentSpanID, tt.parent)
+			}
+			if query.TraceID != root.TraceID {
+				t.Errorf("child trace id = %s, want %s", query.TraceID, root.TraceID)
+			}
+			if query.ParentSpanID != root.SpanID {
+				t.Errorf("child parent = %s, want %s", query.ParentSpanID, root.SpanID)
+			}
+			if root.Service != "delivery" {
+				t.Errorf("service.name = %q, want delivery", root.Service)
+			}
+			if query.Attributes["sentry.op"] != "db.sql.query" {
+				t.Errorf("sentry.op = %q, want db.sql.query", query.Attributes["sentry.op"])
+			}
+
+			want := fmt.Sprintf("00-%s-%s-01", root.TraceID, query.SpanID)
+			if got := headers.Get("traceparent"); got != want {
+				t.Errorf("traceparent = %q, want %q", got, want)
+			}
+			// The Sentry headers carry the same trace as traceparent.
+			sentryTrace := strings.Split(headers.Get("sentry-trace"), "-")
+			if len(sentryTrace) != 3 || sentryTrace[0] != root.TraceID {
+				t.Errorf("sentry-trace = %q, want trace id %s", headers.Get("sentry-trace"), root.TraceID)
+			}
+			if baggage := headers.Get("baggage"); !strings.Contains(baggage, "sentry-trace_id="+root.TraceID) {
+				t.Errorf("baggage = %q, want sentry-trace_id=%s", baggage, root.TraceID)
+			}
+			if traceID != root.TraceID || spanID != query.SpanID {
+				t.Errorf("IDs() = %s, %s, want %s, %s", traceID, spanID, root.TraceID, query.SpanID)
+			}
+		})
+	}
+}
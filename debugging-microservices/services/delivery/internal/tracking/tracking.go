@@ -0,0 +1,66 @@
+package tracking
+
+import (
+	"delivery/internal/models"
+	"sync"
+	"time"
+)
+
+// Update is a change in a delivery's status or position, pushed to everyone
+// following the delivery.
+type Update struct {
+	OrderID  int
+	Status   string
+	DriverID string
+	Location *models.DeliveryLocation
+	At       time.Time
+}
+
+// Hub fans delivery updates out to the subscribers of each order within this
+// instance.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan Update]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[int]map[chan Update]struct{}),
+	}
+}
+
+// Subscribe starts following an order's delivery. The returned function
+// stops following it and must be called once the caller is done.
+func (h *Hub) Subscribe(orderID int) (<-chan Update, func()) {
+	updates := make(chan Update, 16)
+
+	h.mu.Lock()
+	if h.subscribers[orderID] == nil {
+		h.subscribers[orderID] = make(map[chan Update]struct{})
+	}
+	h.subscribers[orderID][updates] = struct{}{}
+	h.mu.Unlock()
+
+	return updates, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[orderID], updates)
+		if len(h.subscribers[orderID]) == 0 {
+			delete(h.subscribers, orderID)
+		}
+	}
+}
+
+// Publish sends an update to the order's subscribers. Subscribers that fall
+// behind miss updates rather than holding up the delivery.
+func (h *Hub) Publish(update Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for subscriber := range h.subscribers[update.OrderID] {
+		select {
+		case subscriber <- update:
+		default:
+		}
+	}
+}
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS drivers (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    available BOOLEAN NOT NULL DEFAULT TRUE,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    capacity INTEGER NOT NULL DEFAULT 1,
+    active_deliveries INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL UNIQUE,
+    customer_id VARCHAR(255) NOT NULL,
+    delivery_address TEXT NOT NULL,
+    driver_id VARCHAR(255) REFERENCES drivers(id),
+    status VARCHAR(50) NOT NULL, -- queued, assigned, delivered
+    sentry_trace TEXT NOT NULL DEFAULT '',
+    baggage TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    assigned_at TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_status ON deliveries(status);
+CREATE INDEX IF NOT EXISTS idx_deliveries_driver_id ON deliveries(driver_id);
\ No newline at end of file
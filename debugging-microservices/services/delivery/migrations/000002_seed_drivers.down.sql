@@ -0,0 +1 @@
+DELETE FROM drivers WHERE id IN ('lazar.nikolov', 'ana.markovic', 'marko.petrovic', 'elena.ristova', 'stefan.ilievski');
\ No newline at end of file
@@ -0,0 +1,7 @@
+INSERT INTO drivers (id, name, latitude, longitude, capacity) VALUES
+  ('lazar.nikolov', 'Lazar Nikolov', 40.7484, -73.9857, 1),
+  ('ana.markovic', 'Ana Markovic', 40.7306, -73.9866, 1),
+  ('marko.petrovic', 'Marko Petrovic', 40.7580, -73.9855, 1),
+  ('elena.ristova', 'Elena Ristova', 40.7061, -74.0087, 1),
+  ('stefan.ilievski', 'Stefan Ilievski', 40.7831, -73.9712, 1)
+ON CONFLICT (id) DO NOTHING;
\ No newline at end of file
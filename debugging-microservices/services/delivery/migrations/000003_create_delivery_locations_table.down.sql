@@ -0,0 +1 @@
+DROP TABLE IF EXISTS delivery_locations;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS delivery_locations (
+    id SERIAL PRIMARY KEY,
+    delivery_id INTEGER NOT NULL REFERENCES deliveries(id) ON DELETE CASCADE,
+    driver_id VARCHAR(255) NOT NULL REFERENCES drivers(id),
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_locations_delivery_id ON delivery_locations(delivery_id, recorded_at);
\ No newline at end of file
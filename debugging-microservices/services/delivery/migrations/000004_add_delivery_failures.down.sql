@@ -0,0 +1,5 @@
+ALTER TABLE deliveries
+    DROP COLUMN IF EXISTS failed_at,
+    DROP COLUMN IF EXISTS failure_details,
+    DROP COLUMN IF EXISTS failure_reason,
+    DROP COLUMN IF EXISTS attempt;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE deliveries
+    ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS failure_details TEXT,
+    ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE deliveries
+    DROP COLUMN IF EXISTS proof_longitude,
+    DROP COLUMN IF EXISTS proof_latitude,
+    DROP COLUMN IF EXISTS proof_content_type,
+    DROP COLUMN IF EXISTS proof_key,
+    DROP COLUMN IF EXISTS proof_kind,
+    DROP COLUMN IF EXISTS recipient_name;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE deliveries
+    ADD COLUMN IF NOT EXISTS recipient_name VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS proof_kind VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS proof_key TEXT,
+    ADD COLUMN IF NOT EXISTS proof_content_type VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS proof_latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS proof_longitude DOUBLE PRECISION;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE deliveries
+    DROP COLUMN IF EXISTS dropoff_longitude,
+    DROP COLUMN IF EXISTS dropoff_latitude;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE deliveries
+    ADD COLUMN IF NOT EXISTS dropoff_latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS dropoff_longitude DOUBLE PRECISION;
\ No newline at end of file
@@ -2,35 +2,75 @@ package main
 
 import (
 	"context"
+	"flag"
+	"inventory/internal/config"
 	"inventory/internal/handlers"
 	messaging "inventory/internal/messaging"
+	"inventory/internal/platform/admin"
+	"inventory/internal/platform/buildinfo"
 	"inventory/internal/platform/consul"
+	"inventory/internal/platform/dynconfig"
+	"inventory/internal/platform/faults"
+	"inventory/internal/platform/health"
+	"inventory/internal/platform/lifecycle"
+	"inventory/internal/platform/logging"
+	"inventory/internal/platform/metrics"
+	"inventory/internal/platform/telemetry"
+	"inventory/internal/platform/tracing"
 	"inventory/internal/repository"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
-	"github.com/getsentry/sentry-go"
 	sentryhttp "github.com/getsentry/sentry-go/http"
 )
 
 func main() {
-	if err := sentry.Init(sentry.ClientOptions{
-		Dsn:              "https://a02b89141ef1a797952e5f3a18e7c0fc@o4506044970565632.ingest.us.sentry.io/4509198465695744",
-		TracesSampleRate: 1.0,
-		AttachStacktrace: true,
-		EnableTracing:    true,
-		TracesSampler: sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
-			if ctx.Span.Name == "GET /health" {
-				return 0.0
-			}
-			return 1.0
-		}),
-	}); err != nil {
-		log.Fatalf("Sentry initialization failed: %s", err)
+	if err := logging.Setup("inventory"); err != nil {
+		log.Fatal(err)
+	}
+	if err := faults.LoadFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	configSource, err := dynconfig.NewSourceFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), 5*time.Second)
+	settings, err := dynconfig.Load[config.Config](loadCtx, configSource, "inventory")
+	cancelLoad()
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	telemetryOptions, err := telemetry.OptionsFromEnv("inventory")
+	if err != nil {
+		log.Fatal(err)
+	}
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// The sample rate can be changed in Consul KV without a restart
+	telemetryOptions.SampleRate = func() float64 {
+		return settings.Current().TracesSampleRate
+	}
+	if err := telemetry.Init(telemetryOptions); err != nil {
+		log.Fatal(err)
+	}
+
+	tracingOptions, err := tracing.OptionsFromEnv("inventory", buildinfo.Read().Version, telemetryOptions.Environment)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), tracingOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracing.OnFinish(metrics.ObserveSpan)
+
 	sentryHandler := sentryhttp.New(sentryhttp.Options{
 		Repanic: true,
 	})
@@ -44,31 +84,80 @@ func main() {
 	if err != nil {
 		log.Fatalf("❌ Failed to create RabbitMQ client: %v", err)
 	}
-	defer rabbitmq.Close()
 
 	handler := handlers.NewInventoryHandler(repo)
 
-	http.HandleFunc("/health", sentryHandler.HandleFunc(handler.HandleHealthCheck))
+	metrics.ConnectionState(rabbitmq.Connected)
 
-	go rabbitmq.ConsumeEvents(
-		context.Background(),
-		handler.HandleInventoryCheck,
-	)
+	checks := health.NewChecker()
+	checks.Add("postgres", repo.Ping)
+	checks.Add("rabbitmq", rabbitmq.Ping)
+	checks.Add("consumer", rabbitmq.ConsumerHealth)
+
+	http.HandleFunc("GET /health/live", sentryHandler.HandleFunc(checks.HandleLive))
+	http.HandleFunc("GET /health/ready", sentryHandler.HandleFunc(checks.HandleReady))
+	// Kept for anything still probing the old endpoint.
+	http.HandleFunc("GET /health", sentryHandler.HandleFunc(checks.HandleReady))
+	http.Handle("GET /metrics", metrics.Handler())
+
+	adminRouter := admin.New(os.Getenv("ADMIN_TOKEN"))
+	adminRouter.Section("config", func(ctx context.Context) interface{} {
+		return settings.Values()
+	})
+	adminRouter.Consumer(rabbitmq)
+	faultsHandler := faults.Handler()
+	adminRouter.Handle("/admin/faults", faultsHandler)
+	adminRouter.Handle("/admin/faults/", faultsHandler)
+	http.Handle("/admin", adminRouter)
+	http.Handle("/admin/", adminRouter)
+
+	http.HandleFunc("GET /products/availability", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleProductAvailability))))
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
 	}
 
+	consulConfig, err := consul.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{Addr: ":" + port}
+
+	lc := lifecycle.New(server)
+	// Registered first so it runs last, after everything that records spans.
+	lc.OnClose(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("❌ OpenTelemetry: Failed to flush spans: %v", err)
+		}
+	})
+	lc.OnClose(rabbitmq.Close)
+
+	lc.Go("Config watcher", settings.Watch)
+
+	lc.Go("AMQP consumer", func(ctx context.Context) error {
+		return rabbitmq.ConsumeEvents(
+			ctx,
+			handler.HandleInventoryCheck,
+			handler.HandleOrderRejected,
+			handler.HandleDeliveryFailed,
+		)
+	})
+
 	go func() {
 		time.Sleep(time.Second * 3)
-		if err := consul.RegisterService(); err != nil {
+		registration, err := consul.RegisterService(consulConfig)
+		if err != nil {
 			log.Fatal("❌ Failed to register with Consul: ", err)
 		}
+		registration.ReportHealth(checks.Ready)
+		lc.SetRegistration(registration.Deregister)
 	}()
 
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := lc.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
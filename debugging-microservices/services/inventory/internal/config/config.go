@@ -0,0 +1,17 @@
+package config
+
+import "fmt"
+
+// Config holds the inventory service settings that can change at runtime.
+// They are read from Consul KV under config/inventory/, falling back to env
+// and then to the defaults below.
+type Config struct {
+	TracesSampleRate float64 `key:"traces_sample_rate" env:"SENTRY_TRACES_SAMPLE_RATE" default:"1.0"`
+}
+
+func (c *Config) Validate() error {
+	if c.TracesSampleRate < 0 || c.TracesSampleRate > 1 {
+		return fmt.Errorf("traces_sample_rate must be between 0 and 1, got %v", c.TracesSampleRate)
+	}
+	return nil
+}
@@ -22,10 +22,63 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type DeliveryFailureReason int32
+
+const (
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_UNSPECIFIED          DeliveryFailureReason = 0
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE DeliveryFailureReason = 1
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_ADDRESS_INVALID      DeliveryFailureReason = 2
+	DeliveryFailureReason_DELIVERY_FAILURE_REASON_DRIVER_INCIDENT      DeliveryFailureReason = 3
+)
+
+// Enum value maps for DeliveryFailureReason.
+var (
+	DeliveryFailureReason_name = map[int32]string{
+		0: "DELIVERY_FAILURE_REASON_UNSPECIFIED",
+		1: "DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE",
+		2: "DELIVERY_FAILURE_REASON_ADDRESS_INVALID",
+		3: "DELIVERY_FAILURE_REASON_DRIVER_INCIDENT",
+	}
+	DeliveryFailureReason_value = map[string]int32{
+		"DELIVERY_FAILURE_REASON_UNSPECIFIED":          0,
+		"DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE": 1,
+		"DELIVERY_FAILURE_REASON_ADDRESS_INVALID":      2,
+		"DELIVERY_FAILURE_REASON_DRIVER_INCIDENT":      3,
+	}
+)
+
+func (x DeliveryFailureReason) Enum() *DeliveryFailureReason {
+	p := new(DeliveryFailureReason)
+	*p = x
+	return p
+}
+
+func (x DeliveryFailureReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DeliveryFailureReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_events_inventory_proto_enumTypes[0].Descriptor()
+}
+
+func (DeliveryFailureReason) Type() protoreflect.EnumType {
+	return &file_proto_events_inventory_proto_enumTypes[0]
+}
+
+func (x DeliveryFailureReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DeliveryFailureReason.Descriptor instead.
+func (DeliveryFailureReason) EnumDescriptor() ([]byte, []int) {
+	return file_proto_events_inventory_proto_rawDescGZIP(), []int{0}
+}
+
 type OrderItem struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
 	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	UnitPrice     float64                `protobuf:"fixed64,3,opt,name=unit_price,json=unitPrice,proto3" json:"unit_price,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -74,6 +127,13 @@ func (x *OrderItem) GetQuantity() int32 {
 	return 0
 }
 
+func (x *OrderItem) GetUnitPrice() float64 {
+	if x != nil {
+		return x.UnitPrice
+	}
+	return 0
+}
+
 type OrderCreatedEvent struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
@@ -218,14 +278,152 @@ func (x *InventoryReservedEvent) GetReservedItems() []*OrderItem {
 	return nil
 }
 
+type DeliveryFailedEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Reason        DeliveryFailureReason  `protobuf:"varint,3,opt,name=reason,proto3,enum=events.DeliveryFailureReason" json:"reason,omitempty"`
+	Details       string                 `protobuf:"bytes,4,opt,name=details,proto3" json:"details,omitempty"`
+	Attempt       int32                  `protobuf:"varint,5,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	WillReattempt bool                   `protobuf:"varint,6,opt,name=will_reattempt,json=willReattempt,proto3" json:"will_reattempt,omitempty"`
+	DriverId      string                 `protobuf:"bytes,7,opt,name=driver_id,json=driverId,proto3" json:"driver_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeliveryFailedEvent) Reset() {
+	*x = DeliveryFailedEvent{}
+	mi := &file_proto_events_inventory_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeliveryFailedEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeliveryFailedEvent) ProtoMessage() {}
+
+func (x *DeliveryFailedEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_events_inventory_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeliveryFailedEvent.ProtoReflect.Descriptor instead.
+func (*DeliveryFailedEvent) Descriptor() ([]byte, []int) {
+	return file_proto_events_inventory_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DeliveryFailedEvent) GetOrderId() int32 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *DeliveryFailedEvent) GetReason() DeliveryFailureReason {
+	if x != nil {
+		return x.Reason
+	}
+	return DeliveryFailureReason_DELIVERY_FAILURE_REASON_UNSPECIFIED
+}
+
+func (x *DeliveryFailedEvent) GetDetails() string {
+	if x != nil {
+		return x.Details
+	}
+	return ""
+}
+
+func (x *DeliveryFailedEvent) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *DeliveryFailedEvent) GetWillReattempt() bool {
+	if x != nil {
+		return x.WillReattempt
+	}
+	return false
+}
+
+func (x *DeliveryFailedEvent) GetDriverId() string {
+	if x != nil {
+		return x.DriverId
+	}
+	return ""
+}
+
+type OrderRejectedEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderRejectedEvent) Reset() {
+	*x = OrderRejectedEvent{}
+	mi := &file_proto_events_inventory_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderRejectedEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderRejectedEvent) ProtoMessage() {}
+
+func (x *OrderRejectedEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_events_inventory_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderRejectedEvent.ProtoReflect.Descriptor instead.
+func (*OrderRejectedEvent) Descriptor() ([]byte, []int) {
+	return file_proto_events_inventory_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *OrderRejectedEvent) GetOrderId() int32 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *OrderRejectedEvent) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
 var File_proto_events_inventory_proto protoreflect.FileDescriptor
 
 const file_proto_events_inventory_proto_rawDesc = "" +
 	"\n" +
-	"\x1cproto/events/inventory.proto\x12\x06events\x1a\x1fgoogle/protobuf/timestamp.proto\"7\n" +
+	"\x1cproto/events/inventory.proto\x12\x06events\x1a\x1fgoogle/protobuf/timestamp.proto\"V\n" +
 	"\tOrderItem\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x1a\n" +
-	"\bquantity\x18\x02 \x01(\x05R\bquantity\"\xcb\x01\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\x12\x1d\n" +
+	"\n" +
+	"unit_price\x18\x03 \x01(\x01R\tunitPrice\"\xcb\x01\n" +
 	"\x11OrderCreatedEvent\x12\x19\n" +
 	"\border_id\x18\x02 \x01(\x05R\aorderId\x12\x1f\n" +
 	"\vcustomer_id\x18\x03 \x01(\tR\n" +
@@ -238,7 +436,22 @@ const file_proto_events_inventory_proto_rawDesc = "" +
 	"\border_id\x18\x02 \x01(\x05R\aorderId\x12\x18\n" +
 	"\asuccess\x18\x03 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x04 \x01(\tR\amessage\x128\n" +
-	"\x0ereserved_items\x18\x05 \x03(\v2\x11.events.OrderItemR\rreservedItemsB\x1bZ\x19inventory/internal/eventsb\x06proto3"
+	"\x0ereserved_items\x18\x05 \x03(\v2\x11.events.OrderItemR\rreservedItems\"\xdf\x01\n" +
+	"\x13DeliveryFailedEvent\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x125\n" +
+	"\x06reason\x18\x03 \x01(\x0e2\x1d.events.DeliveryFailureReasonR\x06reason\x12\x18\n" +
+	"\adetails\x18\x04 \x01(\tR\adetails\x12\x18\n" +
+	"\aattempt\x18\x05 \x01(\x05R\aattempt\x12%\n" +
+	"\x0ewill_reattempt\x18\x06 \x01(\bR\rwillReattempt\x12\x1b\n" +
+	"\tdriver_id\x18\a \x01(\tR\bdriverId\"G\n" +
+	"\x12OrderRejectedEvent\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason*\xcc\x01\n" +
+	"\x15DeliveryFailureReason\x12'\n" +
+	"#DELIVERY_FAILURE_REASON_UNSPECIFIED\x10\x00\x120\n" +
+	",DELIVERY_FAILURE_REASON_CUSTOMER_UNREACHABLE\x10\x01\x12+\n" +
+	"'DELIVERY_FAILURE_REASON_ADDRESS_INVALID\x10\x02\x12+\n" +
+	"'DELIVERY_FAILURE_REASON_DRIVER_INCIDENT\x10\x03B\x1bZ\x19inventory/internal/eventsb\x06proto3"
 
 var (
 	file_proto_events_inventory_proto_rawDescOnce sync.Once
@@ -252,22 +465,27 @@ func file_proto_events_inventory_proto_rawDescGZIP() []byte {
 	return file_proto_events_inventory_proto_rawDescData
 }
 
-var file_proto_events_inventory_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_events_inventory_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_events_inventory_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_proto_events_inventory_proto_goTypes = []any{
-	(*OrderItem)(nil),              // 0: events.OrderItem
-	(*OrderCreatedEvent)(nil),      // 1: events.OrderCreatedEvent
-	(*InventoryReservedEvent)(nil), // 2: events.InventoryReservedEvent
-	(*timestamppb.Timestamp)(nil),  // 3: google.protobuf.Timestamp
+	(DeliveryFailureReason)(0),     // 0: events.DeliveryFailureReason
+	(*OrderItem)(nil),              // 1: events.OrderItem
+	(*OrderCreatedEvent)(nil),      // 2: events.OrderCreatedEvent
+	(*InventoryReservedEvent)(nil), // 3: events.InventoryReservedEvent
+	(*DeliveryFailedEvent)(nil),    // 4: events.DeliveryFailedEvent
+	(*OrderRejectedEvent)(nil),     // 5: events.OrderRejectedEvent
+	(*timestamppb.Timestamp)(nil),  // 6: google.protobuf.Timestamp
 }
 var file_proto_events_inventory_proto_depIdxs = []int32{
-	3, // 0: events.OrderCreatedEvent.created_at:type_name -> google.protobuf.Timestamp
-	0, // 1: events.OrderCreatedEvent.items:type_name -> events.OrderItem
-	0, // 2: events.InventoryReservedEvent.reserved_items:type_name -> events.OrderItem
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	6, // 0: events.OrderCreatedEvent.created_at:type_name -> google.protobuf.Timestamp
+	1, // 1: events.OrderCreatedEvent.items:type_name -> events.OrderItem
+	1, // 2: events.InventoryReservedEvent.reserved_items:type_name -> events.OrderItem
+	0, // 3: events.DeliveryFailedEvent.reason:type_name -> events.DeliveryFailureReason
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_proto_events_inventory_proto_init() }
@@ -280,13 +498,14 @@ func file_proto_events_inventory_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_events_inventory_proto_rawDesc), len(file_proto_events_inventory_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      1,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_proto_events_inventory_proto_goTypes,
 		DependencyIndexes: file_proto_events_inventory_proto_depIdxs,
+		EnumInfos:         file_proto_events_inventory_proto_enumTypes,
 		MessageInfos:      file_proto_events_inventory_proto_msgTypes,
 	}.Build()
 	File_proto_events_inventory_proto = out.File
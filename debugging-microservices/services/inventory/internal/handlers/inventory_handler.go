@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"inventory/internal/events"
 	"inventory/internal/models"
+	"inventory/internal/platform/logging"
 	"inventory/internal/repository"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
 )
 
 type InventoryHandler struct {
@@ -17,13 +22,60 @@ func NewInventoryHandler(repo *repository.InventoryRepository) *InventoryHandler
 	return &InventoryHandler{repo: repo}
 }
 
-func (h *InventoryHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// productAvailability is what other services see of a product when they
+// check stock synchronously.
+type productAvailability struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Available int     `json:"available"`
+	Price     float64 `json:"price"`
 }
 
-func (h *InventoryHandler) HandleInventoryCheck(ctx context.Context, orderId int32, items []*events.OrderItem) (bool, string, error) {
-	log.Printf("📦 Processing inventory check for order %d", orderId)
+// HandleProductAvailability reports the current stock of the products in
+// ?ids=1,2,3. Unknown products are left out of the response. Nothing is
+// reserved; the order.created event remains the source of truth.
+func (h *InventoryHandler) HandleProductAvailability(w http.ResponseWriter, r *http.Request) {
+	var ids []int
+	for _, value := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "invalid product id "+value, http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+
+	products, err := h.repo.GetProducts(r.Context(), ids)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]productAvailability, len(products))
+	for i, product := range products {
+		response[i] = productAvailability{
+			ID:        product.ID,
+			Name:      product.Name,
+			Available: product.Quantity,
+			Price:     product.Price,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *InventoryHandler) HandleInventoryCheck(ctx context.Context, orderId int32, items []*events.OrderItem) (bool, string, []*events.OrderItem, error) {
+	logging.Infof(ctx, "📦 Processing inventory check for order %d", orderId)
 	reservations := make([]*models.InventoryReservation, len(items))
 	for i, item := range items {
 		reservations[i] = &models.InventoryReservation{
@@ -33,5 +85,48 @@ func (h *InventoryHandler) HandleInventoryCheck(ctx context.Context, orderId int
 		}
 	}
 
-	return h.repo.CheckAndReserveInventory(ctx, int(orderId), reservations)
+	success, message, err := h.repo.CheckAndReserveInventory(ctx, int(orderId), reservations)
+	if err != nil || !success {
+		return success, message, items, err
+	}
+
+	reservedItems := make([]*events.OrderItem, len(reservations))
+	for i, reservation := range reservations {
+		reservedItems[i] = &events.OrderItem{
+			Id:        int32(reservation.ProductID),
+			Quantity:  int32(reservation.Quantity),
+			UnitPrice: reservation.UnitPrice,
+		}
+	}
+
+	return success, message, reservedItems, nil
+}
+
+// HandleOrderRejected releases the stock reserved for an order that was
+// rejected after inventory reserved it, by the order service or the kitchen.
+// Nothing was cooked, so all of it goes back on the shelf.
+func (h *InventoryHandler) HandleOrderRejected(ctx context.Context, orderId int32, reason string) error {
+	released, _, err := h.repo.ReturnReservations(ctx, int(orderId), false)
+	if err != nil {
+		return err
+	}
+
+	logging.Infof(ctx, "↩️ Order %d rejected (%s): %d reservations released", orderId, reason, released)
+	return nil
+}
+
+// HandleDeliveryFailed settles the order's reservations once its delivery is
+// returned to the kitchen. Failures that will be reattempted keep them.
+func (h *InventoryHandler) HandleDeliveryFailed(ctx context.Context, orderId int32, willReattempt bool) error {
+	if willReattempt {
+		return nil
+	}
+
+	released, writtenOff, err := h.repo.ReturnReservations(ctx, int(orderId), true)
+	if err != nil {
+		return err
+	}
+
+	logging.Infof(ctx, "↩️ Order %d returned: %d reservations released, %d written off", orderId, released, writtenOff)
+	return nil
 }
@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterExchange receives the messages consumers reject, such as ones
+// that don't decode, and routes them to the dead-letter queue of the queue
+// they were rejected from.
+const DeadLetterExchange = "order_events.dlx"
+
+// DeadLetterQueue is the queue messages rejected from queue end up in.
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+// declareDeadLetterQueue declares the dead-letter queue of queue and returns
+// the arguments queue needs to be declared with to use it. Dead-lettered
+// messages keep their original routing key in the x-death header.
+//
+// A queue declared before it had these arguments can't be redeclared with
+// them; the broker refuses with PRECONDITION_FAILED until the queue is
+// deleted, as the README describes.
+func declareDeadLetterQueue(ch *amqp.Channel, queue string) (amqp.Table, error) {
+	err := ch.ExchangeDeclare(
+		DeadLetterExchange,
+		"direct",
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("❌ AMQP: Failed to declare dead-letter exchange: %v", err)
+	}
+
+	dlq := DeadLetterQueue(queue)
+	_, err = ch.QueueDeclare(
+		dlq,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("❌ AMQP: Failed to declare dead-letter queue: %v", err)
+	}
+
+	err = ch.QueueBind(dlq, dlq, DeadLetterExchange, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("❌ AMQP: Failed to bind dead-letter queue: %v", err)
+	}
+
+	return amqp.Table{
+		"x-dead-letter-exchange":    DeadLetterExchange,
+		"x-dead-letter-routing-key": dlq,
+	}, nil
+}
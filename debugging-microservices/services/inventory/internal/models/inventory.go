@@ -3,11 +3,14 @@ package models
 import "time"
 
 type Product struct {
-	ID        string    `db:"id"`
-	Name      string    `db:"name"`
-	Quantity  int       `db:"quantity"`
-	Price     float64   `db:"price"`
-	UpdatedAt time.Time `db:"updated_at"`
+	ID       string  `db:"id"`
+	Name     string  `db:"name"`
+	Quantity int     `db:"quantity"`
+	Price    float64 `db:"price"`
+	// Resellable products go back on the shelf when a delivery is returned,
+	// everything else is written off.
+	Resellable bool      `db:"resellable"`
+	UpdatedAt  time.Time `db:"updated_at"`
 }
 
 type InventoryReservation struct {
@@ -15,7 +18,8 @@ type InventoryReservation struct {
 	ProductID int       `db:"product_id"`
 	OrderID   int       `db:"order_id"`
 	Quantity  int       `db:"quantity"`
-	Status    string    `db:"status"` // reserved, released, confirmed
+	UnitPrice float64   `db:"unit_price"`
+	Status    string    `db:"status"` // reserved, released, confirmed, written_off
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 }
@@ -0,0 +1,168 @@
+// Package admin serves the /admin endpoints used to look inside a running
+// service: what it's consuming, the background work it's doing, the config
+// in effect and the build it runs, along with a few switches such as
+// pausing consumption and changing the log level.
+//
+// Every endpoint requires the token in ADMIN_TOKEN, sent as a bearer token
+// or in the X-Admin-Token header. Without a token they're all disabled.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"inventory/internal/platform/buildinfo"
+	"inventory/internal/platform/logging"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Router serves the /admin endpoints. Mount it on both "/admin" and
+// "/admin/".
+type Router struct {
+	token string
+	mux   *http.ServeMux
+
+	mu       sync.Mutex
+	sections []section
+}
+
+type section struct {
+	name  string
+	state func(ctx context.Context) interface{}
+}
+
+// New returns a Router that accepts token. An empty token disables it.
+func New(token string) *Router {
+	r := &Router{token: token, mux: http.NewServeMux()}
+	if token == "" {
+		logging.Warnf(context.Background(), "⚠️ ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
+
+	r.mux.HandleFunc("GET /admin", r.handleOverview)
+	r.mux.HandleFunc("GET /admin/log-level", handleGetLogLevel)
+	r.mux.HandleFunc("PUT /admin/log-level", handleSetLogLevel)
+	r.Section("build", func(ctx context.Context) interface{} {
+		return buildinfo.Read()
+	})
+
+	return r
+}
+
+// Section adds GET /admin/<name>, serving what state returns as JSON. It's
+// also included in GET /admin, which shows every section at once.
+func (r *Router) Section(name string, state func(ctx context.Context) interface{}) {
+	r.mu.Lock()
+	r.sections = append(r.sections, section{name: name, state: state})
+	r.mu.Unlock()
+
+	r.mux.HandleFunc("GET /admin/"+name, func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, state(req.Context()))
+	})
+}
+
+// Handle adds an endpoint, such as an action. pattern must be under /admin.
+func (r *Router) Handle(pattern string, handler http.Handler) {
+	r.mux.Handle(pattern, handler)
+}
+
+func (r *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	r.mux.HandleFunc(pattern, handler)
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.token == "" {
+		http.NotFound(w, req)
+		return
+	}
+	if !r.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "❌ Missing or invalid admin token", http.StatusUnauthorized)
+		return
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+func (r *Router) authorized(req *http.Request) bool {
+	token := req.Header.Get("X-Admin-Token")
+	if bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) == 1
+}
+
+func (r *Router) handleOverview(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	sections := append([]section(nil), r.sections...)
+	r.mu.Unlock()
+
+	overview := map[string]interface{}{
+		"log_level": logging.Level.Level().String(),
+	}
+	for _, s := range sections {
+		overview[s.name] = s.state(req.Context())
+	}
+	writeJSON(w, http.StatusOK, overview)
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevel{Level: logging.Level.Level().String()})
+}
+
+// handleSetLogLevel changes the log level until the next restart, e.g. to
+// debug while chasing a stuck order.
+func handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body logLevel
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(body.Level)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	previous := logging.Level.Level()
+	logging.Level.Set(level)
+	logging.Warnf(r.Context(), "♻️ Log level changed from %s to %s", previous, level)
+
+	writeJSON(w, http.StatusOK, logLevel{Level: level.String()})
+}
+
+// ConsumerControl is what the consumer endpoints need from a messaging
+// client.
+type ConsumerControl interface {
+	ConsumerState() interface{}
+	PauseConsuming()
+	ResumeConsuming()
+}
+
+// Consumer adds GET /admin/consumer and the actions
+// POST /admin/consumer/pause and POST /admin/consumer/resume.
+func (r *Router) Consumer(consumer ConsumerControl) {
+	r.Section("consumer", func(ctx context.Context) interface{} {
+		return consumer.ConsumerState()
+	})
+	r.HandleFunc("POST /admin/consumer/pause", func(w http.ResponseWriter, req *http.Request) {
+		consumer.PauseConsuming()
+		writeJSON(w, http.StatusOK, consumer.ConsumerState())
+	})
+	r.HandleFunc("POST /admin/consumer/resume", func(w http.ResponseWriter, req *http.Request) {
+		consumer.ResumeConsuming()
+		writeJSON(w, http.StatusOK, consumer.ConsumerState())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
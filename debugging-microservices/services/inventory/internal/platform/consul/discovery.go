@@ -0,0 +1,256 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inventory/internal/platform/tracing"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	consulapi "github.com/hashicorp/consul/api"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// watchWaitTime is how long a blocking query waits for the catalog to
+	// change before Consul answers with the same index.
+	watchWaitTime = 5 * time.Minute
+	// watchRetryInterval is how long a failed watch waits before retrying,
+	// serving the last known instances in the meantime.
+	watchRetryInterval = 2 * time.Second
+)
+
+var ErrNoHealthyInstances = errors.New("no healthy instances")
+
+// Instance is a healthy, addressable instance of a service.
+type Instance struct {
+	ID      string
+	Address string
+	Port    int
+}
+
+func (i Instance) HostPort() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// Discovery resolves healthy service instances from Consul. The first lookup
+// of a service starts a blocking-query watch that keeps a local cache up to
+// date, so calls don't hit Consul on the hot path.
+type Discovery struct {
+	client *consulapi.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+type watch struct {
+	// ready is closed once the first query has completed, successfully or
+	// not.
+	ready chan struct{}
+	next  atomic.Uint64
+
+	mu        sync.RWMutex
+	instances []Instance
+	err       error
+}
+
+func NewDiscovery(agentAddress string) (*Discovery, error) {
+	clientConfig := consulapi.DefaultConfig()
+	if agentAddress != "" {
+		clientConfig.Address = agentAddress
+	}
+
+	client, err := consulapi.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Failed to create Consul client: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Discovery{
+		client:  client,
+		ctx:     ctx,
+		cancel:  cancel,
+		watches: map[string]*watch{},
+	}, nil
+}
+
+// Instances returns the healthy instances of a service. The first call for a
+// service waits for Consul to answer; later calls are served from the cache.
+func (d *Discovery) Instances(ctx context.Context, service string) ([]Instance, error) {
+	w := d.watch(service)
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if len(w.instances) == 0 {
+		if w.err != nil {
+			return nil, fmt.Errorf("❌ Failed to resolve %s: %w", service, w.err)
+		}
+		return nil, fmt.Errorf("❌ Failed to resolve %s: %w", service, ErrNoHealthyInstances)
+	}
+
+	return w.instances, nil
+}
+
+// Next picks a healthy instance of a service, round-robin.
+func (d *Discovery) Next(ctx context.Context, service string) (Instance, error) {
+	instances, err := d.Instances(ctx, service)
+	if err != nil {
+		return Instance{}, err
+	}
+
+	n := d.watch(service).next.Add(1) - 1
+	return instances[n%uint64(len(instances))], nil
+}
+
+// Close stops every watch.
+func (d *Discovery) Close() {
+	d.cancel()
+}
+
+func (d *Discovery) watch(service string) *watch {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w, ok := d.watches[service]
+	if !ok {
+		w = &watch{ready: make(chan struct{})}
+		d.watches[service] = w
+		go d.run(service, w)
+	}
+
+	return w
+}
+
+func (d *Discovery) run(service string, w *watch) {
+	var index uint64
+	var readyOnce sync.Once
+	ready := func() { readyOnce.Do(func() { close(w.ready) }) }
+	defer ready()
+
+	for d.ctx.Err() == nil {
+		options := (&consulapi.QueryOptions{
+			WaitIndex: index,
+			WaitTime:  watchWaitTime,
+		}).WithContext(d.ctx)
+
+		entries, meta, err := d.client.Health().Service(service, "", true, options)
+		if err != nil {
+			if d.ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("❌ Consul: Failed to watch %s: %v", service, err)
+			w.mu.Lock()
+			w.err = err
+			w.mu.Unlock()
+			ready()
+
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-time.After(watchRetryInterval):
+			}
+			continue
+		}
+
+		// Consul may hand back a lower index, e.g. after a leader change;
+		// start over rather than blocking on an index that won't come.
+		if meta.LastIndex < index {
+			index = 0
+		} else {
+			index = meta.LastIndex
+		}
+
+		instances := make([]Instance, 0, len(entries))
+		for _, entry := range entries {
+			address := entry.Service.Address
+			if address == "" {
+				address = entry.Node.Address
+			}
+			instances = append(instances, Instance{
+				ID:      entry.Service.ID,
+				Address: address,
+				Port:    entry.Service.Port,
+			})
+		}
+
+		w.mu.Lock()
+		if len(instances) != len(w.instances) {
+			log.Printf("♻️ Consul: %s has %d healthy instance(s)", service, len(instances))
+		}
+		w.instances = instances
+		w.err = nil
+		w.mu.Unlock()
+		ready()
+	}
+}
+
+// HTTPClient returns a client for calling other services by name, as in
+// http://inventory/products. Each request goes to the next healthy instance
+// of the service, runs in an http.client span and carries the sentry-trace,
+// baggage and traceparent headers so the callee continues the trace.
+func (d *Discovery) HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &discoveryTransport{
+			discovery: d,
+			base:      http.DefaultTransport,
+		},
+	}
+}
+
+type discoveryTransport struct {
+	discovery *Discovery
+	base      http.RoundTripper
+}
+
+func (t *discoveryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	service := req.URL.Hostname()
+
+	span := tracing.StartSpan(ctx, "http.client", fmt.Sprintf("%s %s", req.Method, req.URL.String()))
+	span.SetData("http.request.method", req.Method)
+	span.SetData("server.address", service)
+	defer span.Finish()
+
+	instance, err := t.discovery.Next(ctx, service)
+	if err != nil {
+		span.Status = sentry.SpanStatusUnavailable
+		return nil, err
+	}
+	span.SetData("network.peer.address", instance.HostPort())
+
+	// RoundTrippers must not modify the caller's request.
+	outgoing := req.Clone(span.Context())
+	outgoing.URL.Host = instance.HostPort()
+	outgoing.Host = service
+	tracing.Inject(span.Context(), propagation.HeaderCarrier(outgoing.Header))
+
+	resp, err := t.base.RoundTrip(outgoing)
+	if err != nil {
+		span.Status = sentry.SpanStatusUnavailable
+		return nil, err
+	}
+
+	span.SetData("http.response.status_code", resp.StatusCode)
+	span.Status = sentry.HTTPtoSpanStatus(resp.StatusCode)
+
+	return resp, nil
+}
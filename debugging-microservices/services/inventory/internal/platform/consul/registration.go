@@ -1,15 +1,14 @@
 package consul
 
 import (
+	"context"
 	"fmt"
+	"inventory/internal/platform/buildinfo"
 	"log"
 	"net"
 	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
+	"time"
 
-	"github.com/google/uuid"
 	consulapi "github.com/hashicorp/consul/api"
 )
 
@@ -30,63 +29,125 @@ func getInternalIP() string {
 	return "127.0.0.1"
 }
 
-func RegisterService() error {
-	log.Println("Registering with Consul...")
+// Registration is a service instance registered with the local Consul agent.
+type Registration struct {
+	client *consulapi.Client
+	ID     string
 
-	consulAddr := os.Getenv("CONSUL_HTTP_ADDR")
-	serviceName := os.Getenv("CONSUL_SERVICE_NAME")
-	servicePort := os.Getenv("CONSUL_SERVICE_PORT")
+	// ttl is set when Consul expects the service to report its own health
+	// instead of polling the readiness endpoint.
+	ttl     time.Duration
+	stopTTL context.CancelFunc
+}
 
-	servicePortInt, err := strconv.Atoi(servicePort)
-	if err != nil {
-		return fmt.Errorf("❌ Failed to convert service port to int: %w", err)
+// ReportHealth keeps a TTL check up to date by running check well within
+// the TTL and passing its result on to Consul. It does nothing when the
+// registration uses an HTTP check.
+func (r *Registration) ReportHealth(check func(ctx context.Context) error) {
+	if r.ttl == 0 {
+		return
 	}
 
-	config := consulapi.DefaultConfig()
-	config.Address = consulAddr
+	ctx, cancel := context.WithCancel(context.Background())
+	r.stopTTL = cancel
+
+	checkID := "service:" + r.ID
+	ticker := time.NewTicker(r.ttl / 3)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			status, output := consulapi.HealthPassing, "ready"
+			if err := check(ctx); err != nil {
+				status, output = consulapi.HealthCritical, err.Error()
+			}
 
-	client, err := consulapi.NewClient(config)
+			if err := r.client.Agent().UpdateTTLOpts(checkID, output, status, (&consulapi.QueryOptions{}).WithContext(ctx)); err != nil && ctx.Err() == nil {
+				log.Printf("❌ Failed to update Consul TTL check: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Deregister removes the instance from Consul so that no new traffic is
+// routed to it. It is the first step of a graceful shutdown.
+func (r *Registration) Deregister() error {
+	if r.stopTTL != nil {
+		r.stopTTL()
+	}
+
+	if err := r.client.Agent().ServiceDeregister(r.ID); err != nil {
+		return fmt.Errorf("❌ Failed to deregister from Consul: %w", err)
+	}
+
+	log.Printf("✅ Successfully deregistered from Consul")
+	return nil
+}
+
+// RegisterService registers this instance with the Consul agent, tagged
+// with its service name and carrying the build's version metadata.
+func RegisterService(config Config) (*Registration, error) {
+	log.Println("Registering with Consul...")
+
+	clientConfig := consulapi.DefaultConfig()
+	if config.AgentAddress != "" {
+		clientConfig.Address = config.AgentAddress
+	}
+
+	client, err := consulapi.NewClient(clientConfig)
 	if err != nil {
-		return fmt.Errorf("❌ Failed to create Consul client: %w", err)
+		return nil, fmt.Errorf("❌ Failed to create Consul client: %w", err)
+	}
+
+	// With a TTL configured, the service reports its own readiness (see
+	// ReportHealth); otherwise Consul polls the readiness endpoint.
+	check := &consulapi.AgentServiceCheck{
+		HTTP:                           config.checkURL(),
+		Interval:                       config.CheckInterval.String(),
+		Timeout:                        config.CheckTimeout.String(),
+		DeregisterCriticalServiceAfter: config.DeregisterAfter.String(),
+	}
+	if config.CheckTTL > 0 {
+		check = &consulapi.AgentServiceCheck{
+			TTL:                            config.CheckTTL.String(),
+			Status:                         consulapi.HealthCritical,
+			DeregisterCriticalServiceAfter: config.DeregisterAfter.String(),
+		}
 	}
 
-	internalIP := getInternalIP()
+	build := buildinfo.Read()
+	meta := map[string]string{
+		"version":     build.Version,
+		"environment": os.Getenv("GO_ENV"),
+		"go_version":  build.GoVersion,
+	}
+	if build.Revision != "" {
+		meta["revision"] = build.Revision
+	}
+	for key, value := range config.Meta {
+		meta[key] = value
+	}
 
 	registration := &consulapi.AgentServiceRegistration{
-		ID:      serviceName + "-" + uuid.New().String(),
-		Name:    serviceName,
-		Port:    servicePortInt,
-		Address: internalIP,
-		Check: &consulapi.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://%s:%d/health", internalIP, servicePortInt),
-			Interval:                       "10s",
-			Timeout:                        "5s",
-			DeregisterCriticalServiceAfter: "30s",
-		},
-		Tags: []string{"order", "microservice"},
-		Meta: map[string]string{
-			"version":     "1.0.0",
-			"environment": os.Getenv("GO_ENV"),
-		},
+		ID:      config.ID,
+		Name:    config.Name,
+		Port:    config.Port,
+		Address: config.Address,
+		Check:   check,
+		Tags:    config.Tags,
+		Meta:    meta,
 	}
 
 	if err := client.Agent().ServiceRegister(registration); err != nil {
-		return fmt.Errorf("❌ Failed to register with Consul: %w", err)
+		return nil, fmt.Errorf("❌ Failed to register with Consul: %w", err)
 	}
 
-	// Set up deregistration on process termination
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		if err := client.Agent().ServiceDeregister(registration.ID); err != nil {
-			log.Printf("❌ Failed to deregister from Consul: %v", err)
-		} else {
-			log.Printf("✅ Successfully deregistered from Consul")
-		}
-		os.Exit(0)
-	}()
-
-	log.Printf("✅ Successfully registered with Consul")
-	return nil
+	log.Printf("✅ Successfully registered with Consul as %s (%s)", config.ID, build.Version)
+	return &Registration{client: client, ID: registration.ID, ttl: config.CheckTTL}, nil
 }
@@ -0,0 +1,142 @@
+package dynconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// Source is a key/value store settings are read from.
+type Source interface {
+	// List returns every key under prefix, relative to it, and the index the
+	// data was read at. With a non-zero waitIndex it blocks until the data
+	// has changed past that index or ctx is done.
+	List(ctx context.Context, prefix string, waitIndex uint64) (map[string]string, uint64, error)
+}
+
+// NewSourceFromEnv reads from the Consul agent at CONSUL_HTTP_ADDR, or from
+// an empty in-memory source when it isn't set, so the service runs on env
+// and defaults alone.
+func NewSourceFromEnv() (Source, error) {
+	address := os.Getenv("CONSUL_HTTP_ADDR")
+	if address == "" {
+		return NewMemorySource(nil), nil
+	}
+	return NewConsulSource(address)
+}
+
+// ConsulSource reads settings from Consul KV using blocking queries.
+type ConsulSource struct {
+	kv *consulapi.KV
+}
+
+func NewConsulSource(address string) (*ConsulSource, error) {
+	clientConfig := consulapi.DefaultConfig()
+	clientConfig.Address = address
+
+	client, err := consulapi.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Failed to create Consul client: %w", err)
+	}
+
+	return &ConsulSource{kv: client.KV()}, nil
+}
+
+func (s *ConsulSource) List(ctx context.Context, prefix string, waitIndex uint64) (map[string]string, uint64, error) {
+	options := (&consulapi.QueryOptions{
+		WaitIndex: waitIndex,
+		WaitTime:  5 * time.Minute,
+	}).WithContext(ctx)
+
+	pairs, meta, err := s.kv.List(prefix, options)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, prefix)
+		// Folders show up as keys ending in a slash
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+		values[key] = string(pair.Value)
+	}
+
+	return values, meta.LastIndex, nil
+}
+
+// MemorySource is an in-memory Source that behaves like Consul KV, including
+// blocking until a change, for running without Consul.
+type MemorySource struct {
+	mu      sync.Mutex
+	values  map[string]string
+	index   uint64
+	changed chan struct{}
+}
+
+// NewMemorySource creates a source holding the given keys, which are full
+// paths such as config/order/tax_rate.
+func NewMemorySource(values map[string]string) *MemorySource {
+	s := &MemorySource{
+		values:  make(map[string]string, len(values)),
+		index:   1,
+		changed: make(chan struct{}),
+	}
+	for key, value := range values {
+		s.values[key] = value
+	}
+	return s
+}
+
+// Set stores a key and wakes up anyone watching it.
+func (s *MemorySource) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.notify()
+}
+
+// Delete removes a key and wakes up anyone watching it.
+func (s *MemorySource) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.notify()
+}
+
+func (s *MemorySource) notify() {
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *MemorySource) List(ctx context.Context, prefix string, waitIndex uint64) (map[string]string, uint64, error) {
+	for {
+		s.mu.Lock()
+		if waitIndex == 0 || s.index > waitIndex {
+			values := map[string]string{}
+			for key, value := range s.values {
+				if strings.HasPrefix(key, prefix) {
+					values[strings.TrimPrefix(key, prefix)] = value
+				}
+			}
+			index := s.index
+			s.mu.Unlock()
+			return values, index, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package faults injects latency, errors and panics at the points the
+// platform packages instrument: HTTP handlers, message processing, database
+// calls and publishes. Faults are described by rules, read from FAULTS at
+// startup and changed at runtime through Handler, so a scenario such as
+// "slow inventory" or "kitchen crash" can be switched on during a demo.
+//
+// Every fault injected is tagged on the active span, so its effects can be
+// told apart from real failures in a trace.
+package faults
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inventory/internal/platform/logging"
+	"inventory/internal/platform/tracing"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Points where faults can be injected.
+const (
+	// PointHTTP is an HTTP handler; the target is its route pattern, such as
+	// "GET /orders/{orderId}".
+	PointHTTP = "http"
+	// PointProcess is the handling of a message; the target is its routing
+	// key.
+	PointProcess = "process"
+	// PointPublish is a publish; the target is its routing key.
+	PointPublish = "publish"
+	// PointDB is a database call; the target is the table it works on.
+	PointDB = "db"
+)
+
+// Kinds of fault.
+const (
+	KindLatency = "latency"
+	KindError   = "error"
+	KindPanic   = "panic"
+)
+
+// ErrInjected is wrapped by every error a fault returns.
+var ErrInjected = errors.New("injected fault")
+
+// Rule describes a fault to inject.
+type Rule struct {
+	// Name identifies the rule, e.g. "slow-inventory".
+	Name string `json:"name"`
+	// Point is where the fault is injected: http, process, publish or db.
+	Point string `json:"point"`
+	// Target narrows Point to a route, routing key or table. It may be a
+	// pattern such as "delivery.*". Empty matches every target.
+	Target string `json:"target,omitempty"`
+	// Kind is latency, error or panic.
+	Kind string `json:"kind"`
+	// Probability is the chance of injecting the fault at each matching
+	// point, from 0 to 1. Unset means always.
+	Probability *float64 `json:"probability,omitempty"`
+	// Latency is how long a latency fault delays the call.
+	Latency Duration `json:"latency,omitempty"`
+	// Message is added to the error or panic.
+	Message string `json:"message,omitempty"`
+	// Scope limits the fault to work on, say, one customer or product: it
+	// only applies when ctx carries every key with the same value. Keys
+	// are set with WithScope; routing_key, customer_id and product_id are
+	// set by the services.
+	Scope map[string]string `json:"scope,omitempty"`
+	// Disabled keeps the rule around without injecting it.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("❌ Fault rule has no name")
+	}
+	switch r.Point {
+	case PointHTTP, PointProcess, PointPublish, PointDB:
+	default:
+		return fmt.Errorf("❌ Fault rule %q has unknown point %q", r.Name, r.Point)
+	}
+	switch r.Kind {
+	case KindLatency:
+		if r.Latency <= 0 {
+			return fmt.Errorf("❌ Fault rule %q needs a latency", r.Name)
+		}
+	case KindError, KindPanic:
+	default:
+		return fmt.Errorf("❌ Fault rule %q has unknown kind %q", r.Name, r.Kind)
+	}
+	if r.Probability != nil && (*r.Probability < 0 || *r.Probability > 1) {
+		return fmt.Errorf("❌ Fault rule %q has a probability outside 0 to 1", r.Name)
+	}
+	if r.Target != "" {
+		if _, err := path.Match(r.Target, ""); err != nil {
+			return fmt.Errorf("❌ Fault rule %q has an invalid target %q: %w", r.Name, r.Target, err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) matches(ctx context.Context, point, target string) bool {
+	if r.Disabled || r.Point != point {
+		return false
+	}
+	if r.Target != "" {
+		if ok, _ := path.Match(r.Target, target); !ok {
+			return false
+		}
+	}
+	for key, value := range r.Scope {
+		if scopeValue(ctx, key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	rules atomic.Pointer[[]Rule]
+
+	randMu sync.Mutex
+	random = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+)
+
+// Rules returns the current rules.
+func Rules() []Rule {
+	if current := rules.Load(); current != nil {
+		return append([]Rule(nil), *current...)
+	}
+	return nil
+}
+
+// SetRules replaces the current rules.
+func SetRules(newRules []Rule) error {
+	names := map[string]bool{}
+	for _, rule := range newRules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("❌ Fault rule %q is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	newRules = append([]Rule(nil), newRules...)
+	rules.Store(&newRules)
+	return nil
+}
+
+// LoadFromEnv sets the rules to the JSON array in FAULTS, if any. Setting
+// FAULTS_SEED makes the probabilities play out the same way on every run.
+func LoadFromEnv() error {
+	if value := os.Getenv("FAULTS_SEED"); value != "" {
+		seed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("❌ Invalid FAULTS_SEED %q: %w", value, err)
+		}
+		randMu.Lock()
+		random = rand.New(rand.NewPCG(seed, seed))
+		randMu.Unlock()
+	}
+
+	value := os.Getenv("FAULTS")
+	if value == "" {
+		return nil
+	}
+
+	var newRules []Rule
+	if err := json.Unmarshal([]byte(value), &newRules); err != nil {
+		return fmt.Errorf("❌ Invalid FAULTS: %w", err)
+	}
+	return SetRules(newRules)
+}
+
+// Inject applies the first enabled rule matching point and target: it
+// sleeps for a latency fault, returns an error wrapping ErrInjected for an
+// error fault, and panics for a panic fault. It returns nil when no fault
+// applies, or ctx's error if ctx is done while sleeping.
+func Inject(ctx context.Context, point, target string) error {
+	current := rules.Load()
+	if current == nil {
+		return nil
+	}
+
+	for _, rule := range *current {
+		if !rule.matches(ctx, point, target) || !roll(rule.Probability) {
+			continue
+		}
+		return inject(ctx, rule, point, target)
+	}
+	return nil
+}
+
+func inject(ctx context.Context, rule Rule, point, target string) error {
+	tracing.Tag(ctx, "fault", rule.Name)
+	tracing.Tag(ctx, "fault.kind", rule.Kind)
+	tracing.Tag(ctx, "fault.point", point)
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTag("fault", rule.Name)
+	}
+
+	description := fmt.Sprintf("%s at %s %s", rule.Name, point, target)
+	if rule.Message != "" {
+		description += ": " + rule.Message
+	}
+
+	switch rule.Kind {
+	case KindLatency:
+		logging.Warnf(ctx, "💥 Injecting %s of latency: %s", time.Duration(rule.Latency), description)
+		timer := time.NewTimer(time.Duration(rule.Latency))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case KindPanic:
+		logging.Warnf(ctx, "💥 Injecting panic: %s", description)
+		panic(fmt.Sprintf("💥 Injected panic: %s", description))
+	default:
+		logging.Warnf(ctx, "💥 Injecting error: %s", description)
+		return fmt.Errorf("❌ %w: %s", ErrInjected, description)
+	}
+}
+
+func roll(probability *float64) bool {
+	if probability == nil {
+		return true
+	}
+	randMu.Lock()
+	defer randMu.Unlock()
+	return random.Float64() < *probability
+}
+
+// Duration is a time.Duration written as a string such as "1.5s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// Check reports whether a dependency is usable. It should return promptly
+// once ctx is done.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single dependency check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body served by the health endpoints.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Err summarizes the failed checks of a report, or returns nil if every
+// check passed.
+func (r Report) Err() error {
+	var errs []error
+	for name, result := range r.Checks {
+		if result.Status != StatusUp {
+			errs = append(errs, fmt.Errorf("%s: %s", name, result.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of a service's dependencies.
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+func NewChecker() *Checker {
+	return &Checker{timeout: defaultCheckTimeout}
+}
+
+// Add registers a dependency check under the given name.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run runs every check concurrently, each bounded by the check timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := nc.check(checkCtx)
+			result := Result{
+				Status:    StatusUp,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[nc.name] = result
+			if err != nil {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Ready runs the checks and returns an error describing the failed ones.
+func (c *Checker) Ready(ctx context.Context) error {
+	return c.Run(ctx).Err()
+}
+
+// HandleLive reports that the process is up and serving requests. It
+// doesn't check dependencies, so a broken database doesn't get the
+// container restarted.
+func (c *Checker) HandleLive(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusUp})
+}
+
+// HandleReady reports whether the service can do its work, with the status
+// and latency of each dependency. It responds 503 if any of them is down,
+// so Consul and Kong stop routing to this instance.
+func (c *Checker) HandleReady(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,182 @@
+package sqltrace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"inventory/internal/platform/logging"
+	"inventory/internal/platform/tracing"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/jmoiron/sqlx"
+)
+
+// Options control the problems a DB reports.
+type Options struct {
+	// SlowQueryThreshold is how long a query may take before it's explained
+	// and reported. Zero turns slow query detection off.
+	SlowQueryThreshold time.Duration
+	// NPlusOneThreshold is how many times the same statement may run in one
+	// transaction before it's reported as an N+1. Zero turns it off.
+	NPlusOneThreshold int
+	// ExplainInterval is how long to wait before explaining the same
+	// statement again.
+	ExplainInterval time.Duration
+}
+
+// explainTimeout bounds the EXPLAIN of a slow query, which runs after the
+// query has returned.
+const explainTimeout = 5 * time.Second
+
+// OptionsFromEnv reads the options from DB_SLOW_QUERY_THRESHOLD (200ms by
+// default), DB_N_PLUS_ONE_THRESHOLD (3 by default) and DB_EXPLAIN_INTERVAL
+// (1m by default).
+func OptionsFromEnv() (Options, error) {
+	options := Options{}
+
+	durations := []struct {
+		key      string
+		fallback string
+		target   *time.Duration
+	}{
+		{"DB_SLOW_QUERY_THRESHOLD", "200ms", &options.SlowQueryThreshold},
+		{"DB_EXPLAIN_INTERVAL", "1m", &options.ExplainInterval},
+	}
+	for _, d := range durations {
+		value, err := time.ParseDuration(getEnv(d.key, d.fallback))
+		if err != nil || value < 0 {
+			return Options{}, fmt.Errorf("❌ Invalid %s %q", d.key, os.Getenv(d.key))
+		}
+		*d.target = value
+	}
+
+	threshold, err := strconv.Atoi(getEnv("DB_N_PLUS_ONE_THRESHOLD", "3"))
+	if err != nil || threshold < 0 {
+		return Options{}, fmt.Errorf("❌ Invalid DB_N_PLUS_ONE_THRESHOLD %q", os.Getenv("DB_N_PLUS_ONE_THRESHOLD"))
+	}
+	options.NPlusOneThreshold = threshold
+
+	return options, nil
+}
+
+// reportSlowQuery flags the span of a slow query and reports the query to
+// Sentry grouped by statement. The plan is fetched in the background, at most
+// once per ExplainInterval for each statement, and sent with the report, which
+// is tagged with the query span's trace so the two can be found together.
+func (d *DB) reportSlowQuery(c *call, duration time.Duration) {
+	c.span.SetData("db.slow_query", true)
+	c.span.SetData("db.duration_ms", duration.Milliseconds())
+
+	logging.Warnf(c.ctx, "🐢 Slow query took %s: %s", duration, c.statement)
+
+	// The caller may go on using its hub, so the report has a copy.
+	hub := hubFromContext(c.ctx).Clone()
+	traceID, spanID := tracing.IDs(c.span.Context())
+
+	if !d.shouldExplain(c.statement, c.start.Add(duration)) {
+		d.captureSlowQuery(hub, c.statement, duration, traceID, spanID, "")
+		return
+	}
+
+	go func() {
+		plan, err := d.explain(c)
+		if err != nil {
+			logging.Warnf(c.ctx, "⚠️ Failed to explain slow query %q: %v", c.statement, err)
+		}
+		d.captureSlowQuery(hub, c.statement, duration, traceID, spanID, plan)
+	}()
+}
+
+func (d *DB) captureSlowQuery(hub *sentry.Hub, statement string, duration time.Duration, traceID, spanID, plan string) {
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		scope.SetFingerprint([]string{"slow-query", statement})
+		scope.SetTag("db.operation", Operation(statement))
+		scope.SetTag("trace_id", traceID)
+		scope.SetContext("query", sentry.Context{
+			"statement":    statement,
+			"duration_ms":  duration.Milliseconds(),
+			"threshold_ms": d.options.SlowQueryThreshold.Milliseconds(),
+			"plan":         plan,
+			"trace_id":     traceID,
+			"span_id":      spanID,
+		})
+		hub.CaptureMessage("Slow query: " + statement)
+	})
+}
+
+func (d *DB) shouldExplain(statement string, now time.Time) bool {
+	if last, ok := d.explained.Load(statement); ok && now.Sub(last.(time.Time)) < d.options.ExplainInterval {
+		return false
+	}
+	d.explained.Store(statement, now)
+	return true
+}
+
+// explain runs EXPLAIN on the query with its original arguments. It doesn't
+// ANALYZE, so the query isn't run a second time. The caller's context may
+// be done by now, so only its values are kept.
+func (d *DB) explain(c *call) (string, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.ctx), explainTimeout)
+	defer cancel()
+
+	query := "EXPLAIN (FORMAT JSON) " + c.query
+
+	var rows *sqlx.Rows
+	var err error
+	if c.namedArg != nil {
+		rows, err = sqlx.NamedQueryContext(ctx, d.db, query, c.namedArg)
+	} else {
+		rows, err = d.db.QueryxContext(ctx, query, c.args...)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var plan json.RawMessage
+	if rows.Next() {
+		if err := rows.Scan(&plan); err != nil {
+			return "", err
+		}
+	}
+	return string(plan), rows.Err()
+}
+
+// reportNPlusOne reports a statement that has run executions times in one
+// transaction, which usually means a loop that should be a single query.
+func (d *DB) reportNPlusOne(c *call, executions int) {
+	c.span.SetData("db.n_plus_one", true)
+	c.span.SetData("db.executions_in_transaction", executions)
+
+	logging.Warnf(c.ctx, "🔁 Statement ran %d times in one transaction, possible N+1: %s", executions, c.statement)
+
+	hub := hubFromContext(c.ctx)
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		scope.SetFingerprint([]string{"n-plus-one", c.statement})
+		scope.SetTag("db.operation", Operation(c.statement))
+		scope.SetContext("query", sentry.Context{
+			"statement":  c.statement,
+			"executions": executions,
+		})
+		hub.CaptureMessage("N+1 query: " + c.statement)
+	})
+}
+
+func hubFromContext(ctx context.Context) *sentry.Hub {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		return hub
+	}
+	return sentry.CurrentHub()
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
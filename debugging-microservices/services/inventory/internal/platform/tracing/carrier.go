@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TableCarrier adapts AMQP message headers for Inject and StartTransaction.
+type TableCarrier amqp.Table
+
+func (c TableCarrier) Get(key string) string {
+	switch value := c[key].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func (c TableCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c TableCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// AMQPHeaders returns message headers carrying the trace of the span in ctx.
+func AMQPHeaders(ctx context.Context) amqp.Table {
+	headers := amqp.Table{}
+	Inject(ctx, TableCarrier(headers))
+	return headers
+}
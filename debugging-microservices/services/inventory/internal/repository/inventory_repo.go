@@ -4,22 +4,23 @@ import (
 	"context"
 	"fmt"
 	"inventory/internal/models"
-	"log"
+	"inventory/internal/platform/faults"
+	"inventory/internal/platform/logging"
+	"inventory/internal/platform/sqltrace"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
 
-	"github.com/getsentry/sentry-go"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type InventoryRepository struct {
-	db *sqlx.DB
+	db *sqltrace.DB
 }
 
 func NewInventoryRepository() (*InventoryRepository, error) {
@@ -33,7 +34,7 @@ func NewInventoryRepository() (*InventoryRepository, error) {
 	}
 
 	// Run migrations
-	log.Println("♻️ Running migrations...")
+	logging.Infof(context.Background(), "♻️ Running migrations...")
 	driver, err := postgres.WithInstance(conn.DB, &postgres.Config{})
 	if err != nil {
 		return nil, err
@@ -61,9 +62,14 @@ func NewInventoryRepository() (*InventoryRepository, error) {
 		return nil, err
 	}
 
-	log.Println("✅ Migrations completed")
+	logging.Infof(context.Background(), "✅ Migrations completed")
 
-	return &InventoryRepository{db: conn}, nil
+	options, err := sqltrace.OptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return &InventoryRepository{db: sqltrace.New(conn, "postgresql", sqltrace.NameFromURL(dbUrl), options)}, nil
 }
 
 func (r *InventoryRepository) CheckAndReserveInventory(ctx context.Context, orderID int, items []*models.InventoryReservation) (bool, string, error) {
@@ -75,16 +81,11 @@ func (r *InventoryRepository) CheckAndReserveInventory(ctx context.Context, orde
 	defer tx.Rollback()
 
 	for _, item := range items {
+		ctx := faults.WithScope(ctx, "product_id", item.ProductID)
+
 		var product models.Product
 		query := "SELECT * FROM products WHERE id = $1 FOR UPDATE"
-		selectSpan := sentry.StartSpan(ctx, "db.sql.execute", []sentry.SpanOption{
-			sentry.WithDescription(query),
-		}...)
-		selectSpan.SetData("db.system", "postgresql")
-		selectSpan.SetData("db.operation", "SELECT")
-		selectSpan.SetData("db.name", "products")
 		err := tx.GetContext(ctx, &product, query, item.ProductID)
-		selectSpan.Finish()
 		if err != nil {
 			return false, fmt.Sprintf("Product %d not found", item.ProductID), err
 		}
@@ -93,31 +94,20 @@ func (r *InventoryRepository) CheckAndReserveInventory(ctx context.Context, orde
 			return false, fmt.Sprintf("Insufficient quantity for product %d (requested: %d, available: %d)", item.ProductID, item.Quantity, product.Quantity), nil
 		}
 
+		// Snapshot the price so the order is billed at what it cost when reserved
+		item.UnitPrice = product.Price
+
 		// Update product quantity
 		query = "UPDATE products SET quantity = quantity - $1, updated_at = $2 WHERE id = $3"
-		updateSpan := sentry.StartSpan(ctx, "db.sql.execute", []sentry.SpanOption{
-			sentry.WithDescription(query),
-		}...)
-		updateSpan.SetData("db.system", "postgresql")
-		updateSpan.SetData("db.operation", "UPDATE")
-		updateSpan.SetData("db.name", "products")
 		_, err = tx.ExecContext(ctx, query, item.Quantity, time.Now(), item.ProductID)
-		updateSpan.Finish()
 
 		if err != nil {
 			return false, "", err
 		}
 
 		// Create reservation
-		query = "INSERT INTO inventory_reservations (order_id, product_id, quantity, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $5)"
-		insertSpan := sentry.StartSpan(ctx, "db.sql.execute", []sentry.SpanOption{
-			sentry.WithDescription(query),
-		}...)
-		insertSpan.SetData("db.system", "postgresql")
-		insertSpan.SetData("db.operation", "INSERT")
-		insertSpan.SetData("db.name", "inventory_reservations")
-		_, err = tx.ExecContext(ctx, query, orderID, item.ProductID, item.Quantity, "reserved", time.Now())
-		insertSpan.Finish()
+		query = "INSERT INTO inventory_reservations (order_id, product_id, quantity, unit_price, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $6)"
+		_, err = tx.ExecContext(ctx, query, orderID, item.ProductID, item.Quantity, item.UnitPrice, "reserved", time.Now())
 
 		if err != nil {
 			return false, "", err
@@ -131,3 +121,83 @@ func (r *InventoryRepository) CheckAndReserveInventory(ctx context.Context, orde
 
 	return true, "Successfully reserved inventory", nil
 }
+
+// ReturnReservations settles the reservations of an order that won't be
+// delivered. Resellable products are released back into stock; the rest is
+// written off if the order was cooked and released otherwise. It returns how
+// many reservations went each way.
+func (r *InventoryRepository) ReturnReservations(ctx context.Context, orderID int, cooked bool) (int, int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer tx.Rollback()
+
+	var reservations []struct {
+		models.InventoryReservation
+		Resellable bool `db:"resellable"`
+	}
+
+	query := `
+		SELECT r.*, p.resellable FROM inventory_reservations r
+		JOIN products p ON p.id = r.product_id
+		WHERE r.order_id = $1 AND r.status = 'reserved'
+		FOR UPDATE
+	`
+	err = tx.SelectContext(ctx, &reservations, query, orderID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	released, writtenOff := 0, 0
+	for _, reservation := range reservations {
+		release := reservation.Resellable || !cooked
+		status := "written_off"
+		if release {
+			status = "released"
+
+			query = "UPDATE products SET quantity = quantity + $1, updated_at = $2 WHERE id = $3"
+			_, err = tx.ExecContext(ctx, query, reservation.Quantity, time.Now(), reservation.ProductID)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+
+		query = "UPDATE inventory_reservations SET status = $1, updated_at = $2 WHERE id = $3"
+		_, err = tx.ExecContext(ctx, query, status, time.Now(), reservation.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if release {
+			released++
+		} else {
+			writtenOff++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return released, writtenOff, nil
+}
+
+// GetProducts loads the given products. Unknown ids are left out.
+func (r *InventoryRepository) GetProducts(ctx context.Context, ids []int) ([]models.Product, error) {
+	query := "SELECT * FROM products WHERE id = ANY($1) ORDER BY id"
+
+	products := []models.Product{}
+	if err := r.db.SelectContext(ctx, &products, query, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// Ping checks that the database is reachable, for the readiness check.
+func (r *InventoryRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
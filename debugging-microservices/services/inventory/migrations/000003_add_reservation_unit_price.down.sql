@@ -0,0 +1 @@
+ALTER TABLE inventory_reservations DROP COLUMN IF EXISTS unit_price;
\ No newline at end of file
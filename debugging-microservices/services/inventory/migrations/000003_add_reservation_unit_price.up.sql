@@ -0,0 +1 @@
+ALTER TABLE inventory_reservations ADD COLUMN IF NOT EXISTS unit_price DECIMAL(10,2) NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE products DROP COLUMN IF EXISTS resellable;
\ No newline at end of file
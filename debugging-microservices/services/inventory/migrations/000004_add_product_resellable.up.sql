@@ -0,0 +1,3 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS resellable BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE products SET resellable = TRUE WHERE id = 5;
\ No newline at end of file
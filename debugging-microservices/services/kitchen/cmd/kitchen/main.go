@@ -2,9 +2,24 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"kitchen/internal/config"
 	"kitchen/internal/handlers"
 	"kitchen/internal/messaging"
+	"kitchen/internal/platform/admin"
+	"kitchen/internal/platform/buildinfo"
 	"kitchen/internal/platform/consul"
+	"kitchen/internal/platform/dynconfig"
+	"kitchen/internal/platform/faults"
+	"kitchen/internal/platform/health"
+	"kitchen/internal/platform/lifecycle"
+	"kitchen/internal/platform/logging"
+	"kitchen/internal/platform/metrics"
+	"kitchen/internal/platform/telemetry"
+	"kitchen/internal/platform/tracing"
+	"kitchen/internal/repository"
+	"kitchen/internal/stations"
 	"log"
 	"net/http"
 	"os"
@@ -15,54 +30,169 @@ import (
 )
 
 func main() {
-	if err := sentry.Init(sentry.ClientOptions{
-		Dsn:              "https://7f46d381d6e1765289f6e99bdb8644e3@o4506044970565632.ingest.us.sentry.io/4509198161346560",
-		TracesSampleRate: 1.0,
-		AttachStacktrace: true,
-		EnableTracing:    true,
-		TracesSampler: sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
-			if ctx.Span.Name == "GET /health" {
-				return 0.0
-			}
-			return 1.0
-		}),
-	}); err != nil {
-		log.Fatalf("Sentry initialization failed: %s", err)
+	if err := logging.Setup("kitchen"); err != nil {
+		log.Fatal(err)
+	}
+	if err := faults.LoadFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	configSource, err := dynconfig.NewSourceFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), 5*time.Second)
+	settings, err := dynconfig.Load[config.Config](loadCtx, configSource, "kitchen")
+	cancelLoad()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	telemetryOptions, err := telemetry.OptionsFromEnv("kitchen")
+	if err != nil {
+		log.Fatal(err)
 	}
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// The sample rate can be changed in Consul KV without a restart
+	telemetryOptions.SampleRate = func() float64 {
+		return settings.Current().TracesSampleRate
+	}
+	if err := telemetry.Init(telemetryOptions); err != nil {
+		log.Fatal(err)
+	}
+
+	tracingOptions, err := tracing.OptionsFromEnv("kitchen", buildinfo.Read().Version, telemetryOptions.Environment)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), tracingOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracing.OnFinish(metrics.ObserveSpan)
 
 	sentryHandler := sentryhttp.New(sentryhttp.Options{
 		Repanic: true,
 	})
 
+	ticketRepo, err := repository.NewTicketRepository()
+	if err != nil {
+		log.Fatal("❌ Failed to create ticket repository: ", err)
+	}
+
 	rabbitmq, err := messaging.NewRabbitMQClient()
 	if err != nil {
 		log.Fatal("❌ Failed to create RabbitMQ client: ", err)
 	}
-	defer rabbitmq.Close()
 
-	handler := handlers.NewKitchenHandler(rabbitmq)
-
-	http.HandleFunc("/health", sentryHandler.HandleFunc(handler.HandleHealthCheck))
+	line, err := stations.NewLineFromEnv()
+	if err != nil {
+		log.Fatal("❌ Failed to set up kitchen stations: ", err)
+	}
 
-	go rabbitmq.ConsumeEvents(
-		context.Background(),
-		handler.HandleReadyForKitchen,
-	)
+	// Cook times set in Consul KV take over from KITCHEN_COOK_TIMES, now and
+	// whenever they change.
+	if err := line.SetCookTimes(settings.Current().CookTimes); err != nil {
+		log.Fatal("❌ Failed to set up kitchen stations: ", err)
+	}
+	settings.OnChange(func(old, new *config.Config) {
+		if old.CookTimes == new.CookTimes {
+			return
+		}
+		if err := line.SetCookTimes(new.CookTimes); err != nil {
+			err = fmt.Errorf("❌ Failed to apply cook times %q: %w", new.CookTimes, err)
+			logging.Errorf(context.Background(), "%v", err)
+			sentry.CaptureException(err)
+		}
+	})
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
 	}
 
+	server := &http.Server{Addr: ":" + port}
+
+	lc := lifecycle.New(server)
+	// Registered first so it runs last, after everything that records spans.
+	lc.OnClose(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("❌ OpenTelemetry: Failed to flush spans: %v", err)
+		}
+	})
+	lc.OnClose(rabbitmq.Close)
+
+	handler := handlers.NewKitchenHandler(rabbitmq, ticketRepo, line, settings, lc.Spawn)
+
+	if err := handler.ResumeTickets(context.Background()); err != nil {
+		log.Fatal("❌ Failed to resume unfinished tickets: ", err)
+	}
+
+	metrics.ConnectionState(rabbitmq.Connected)
+
+	checks := health.NewChecker()
+	checks.Add("postgres", ticketRepo.Ping)
+	checks.Add("rabbitmq", rabbitmq.Ping)
+	checks.Add("consumer", rabbitmq.ConsumerHealth)
+
+	http.HandleFunc("GET /health/live", sentryHandler.HandleFunc(checks.HandleLive))
+	http.HandleFunc("GET /health/ready", sentryHandler.HandleFunc(checks.HandleReady))
+	// Kept for anything still probing the old endpoint.
+	http.HandleFunc("GET /health", sentryHandler.HandleFunc(checks.HandleReady))
+	http.Handle("GET /metrics", metrics.Handler())
+
+	adminRouter := admin.New(os.Getenv("ADMIN_TOKEN"))
+	adminRouter.Section("config", func(ctx context.Context) interface{} {
+		return settings.Values()
+	})
+	adminRouter.Consumer(rabbitmq)
+	adminRouter.Section("cooking", func(ctx context.Context) interface{} {
+		return handler.Cooking()
+	})
+	adminRouter.Section("stations", func(ctx context.Context) interface{} {
+		return line.State()
+	})
+	faultsHandler := faults.Handler()
+	adminRouter.Handle("/admin/faults", faultsHandler)
+	adminRouter.Handle("/admin/faults/", faultsHandler)
+	http.Handle("/admin", adminRouter)
+	http.Handle("/admin/", adminRouter)
+
+	http.HandleFunc("GET /tickets", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleListTickets))))
+	http.HandleFunc("POST /tickets/{orderId}/start", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleStartTicket))))
+	http.HandleFunc("POST /tickets/{orderId}/complete", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleCompleteTicket))))
+	http.HandleFunc("POST /tickets/{orderId}/reject", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleRejectTicket))))
+
+	consulConfig, err := consul.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lc.Go("Config watcher", settings.Watch)
+
+	lc.Go("AMQP consumer", func(ctx context.Context) error {
+		return rabbitmq.ConsumeEvents(
+			ctx,
+			handler.HandleReadyForKitchen,
+		)
+	})
+
 	go func() {
 		time.Sleep(time.Second * 3)
-		if err := consul.RegisterService(); err != nil {
+		registration, err := consul.RegisterService(consulConfig)
+		if err != nil {
 			log.Fatal("❌ Failed to register with Consul: ", err)
 		}
+		registration.ReportHealth(checks.Ready)
+		lc.SetRegistration(registration.Deregister)
 	}()
 
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := lc.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
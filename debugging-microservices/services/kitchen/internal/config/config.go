@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"kitchen/internal/stations"
+)
+
+// Config holds the kitchen service settings that can change at runtime.
+// They are read from Consul KV under config/kitchen/, falling back to env
+// and then to the defaults below.
+type Config struct {
+	// AutoCook cooks tickets on the stations' timers. When it's off, tickets
+	// wait for kitchen staff to start and complete them over HTTP.
+	AutoCook bool `key:"auto_cook" env:"KITCHEN_AUTO_COOK" default:"true"`
+	// CookTimes is the cook time range of each station, in the
+	// KITCHEN_COOK_TIMES format.
+	CookTimes        string  `key:"cook_times" env:"KITCHEN_COOK_TIMES" default:"oven=15s-25s,grill=10s-20s,cold_prep=5s-10s"`
+	TracesSampleRate float64 `key:"traces_sample_rate" env:"SENTRY_TRACES_SAMPLE_RATE" default:"1.0"`
+}
+
+func (c *Config) Validate() error {
+	if err := stations.CheckCookTimes(c.CookTimes); err != nil {
+		return fmt.Errorf("cook_times: %w", err)
+	}
+	if c.TracesSampleRate < 0 || c.TracesSampleRate > 1 {
+		return fmt.Errorf("traces_sample_rate must be between 0 and 1, got %v", c.TracesSampleRate)
+	}
+	return nil
+}
@@ -9,7 +9,7 @@ package events
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
-	_ "google.golang.org/protobuf/types/known/timestamppb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -127,10 +127,11 @@ func (x *ReadyForKitchenEvent) GetItems() []*OrderItem {
 }
 
 type KitchenAcceptedOrderEvent struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	OrderId          int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	EstimatedReadyAt *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=estimated_ready_at,json=estimatedReadyAt,proto3" json:"estimated_ready_at,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *KitchenAcceptedOrderEvent) Reset() {
@@ -170,6 +171,13 @@ func (x *KitchenAcceptedOrderEvent) GetOrderId() int32 {
 	return 0
 }
 
+func (x *KitchenAcceptedOrderEvent) GetEstimatedReadyAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EstimatedReadyAt
+	}
+	return nil
+}
+
 type OrderCookedEvent struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
@@ -222,6 +230,58 @@ func (x *OrderCookedEvent) GetItems() []*OrderItem {
 	return nil
 }
 
+type KitchenRejectedOrderEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OrderId       int32                  `protobuf:"varint,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KitchenRejectedOrderEvent) Reset() {
+	*x = KitchenRejectedOrderEvent{}
+	mi := &file_proto_events_kitchen_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KitchenRejectedOrderEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KitchenRejectedOrderEvent) ProtoMessage() {}
+
+func (x *KitchenRejectedOrderEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_events_kitchen_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KitchenRejectedOrderEvent.ProtoReflect.Descriptor instead.
+func (*KitchenRejectedOrderEvent) Descriptor() ([]byte, []int) {
+	return file_proto_events_kitchen_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *KitchenRejectedOrderEvent) GetOrderId() int32 {
+	if x != nil {
+		return x.OrderId
+	}
+	return 0
+}
+
+func (x *KitchenRejectedOrderEvent) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
 var File_proto_events_kitchen_proto protoreflect.FileDescriptor
 
 const file_proto_events_kitchen_proto_rawDesc = "" +
@@ -232,12 +292,16 @@ const file_proto_events_kitchen_proto_rawDesc = "" +
 	"\bquantity\x18\x02 \x01(\x05R\bquantity\"Z\n" +
 	"\x14ReadyForKitchenEvent\x12\x19\n" +
 	"\border_id\x18\x02 \x01(\x05R\aorderId\x12'\n" +
-	"\x05items\x18\x03 \x03(\v2\x11.events.OrderItemR\x05items\"6\n" +
+	"\x05items\x18\x03 \x03(\v2\x11.events.OrderItemR\x05items\"\x80\x01\n" +
 	"\x19KitchenAcceptedOrderEvent\x12\x19\n" +
-	"\border_id\x18\x02 \x01(\x05R\aorderId\"V\n" +
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x12H\n" +
+	"\x12estimated_ready_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x10estimatedReadyAt\"V\n" +
 	"\x10OrderCookedEvent\x12\x19\n" +
 	"\border_id\x18\x02 \x01(\x05R\aorderId\x12'\n" +
-	"\x05items\x18\x03 \x03(\v2\x11.events.OrderItemR\x05itemsB\x19Z\x17kitchen/internal/eventsb\x06proto3"
+	"\x05items\x18\x03 \x03(\v2\x11.events.OrderItemR\x05items\"N\n" +
+	"\x19KitchenRejectedOrderEvent\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\x05R\aorderId\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reasonB\x19Z\x17kitchen/internal/eventsb\x06proto3"
 
 var (
 	file_proto_events_kitchen_proto_rawDescOnce sync.Once
@@ -251,21 +315,24 @@ func file_proto_events_kitchen_proto_rawDescGZIP() []byte {
 	return file_proto_events_kitchen_proto_rawDescData
 }
 
-var file_proto_events_kitchen_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_proto_events_kitchen_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_proto_events_kitchen_proto_goTypes = []any{
 	(*OrderItem)(nil),                 // 0: events.OrderItem
 	(*ReadyForKitchenEvent)(nil),      // 1: events.ReadyForKitchenEvent
 	(*KitchenAcceptedOrderEvent)(nil), // 2: events.KitchenAcceptedOrderEvent
 	(*OrderCookedEvent)(nil),          // 3: events.OrderCookedEvent
+	(*KitchenRejectedOrderEvent)(nil), // 4: events.KitchenRejectedOrderEvent
+	(*timestamppb.Timestamp)(nil),     // 5: google.protobuf.Timestamp
 }
 var file_proto_events_kitchen_proto_depIdxs = []int32{
 	0, // 0: events.ReadyForKitchenEvent.items:type_name -> events.OrderItem
-	0, // 1: events.OrderCookedEvent.items:type_name -> events.OrderItem
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	5, // 1: events.KitchenAcceptedOrderEvent.estimated_ready_at:type_name -> google.protobuf.Timestamp
+	0, // 2: events.OrderCookedEvent.items:type_name -> events.OrderItem
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_proto_events_kitchen_proto_init() }
@@ -279,7 +346,7 @@ func file_proto_events_kitchen_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_events_kitchen_proto_rawDesc), len(file_proto_events_kitchen_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
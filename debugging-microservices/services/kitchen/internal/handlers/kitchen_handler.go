@@ -2,76 +2,604 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"kitchen/internal/config"
 	"kitchen/internal/events"
 	"kitchen/internal/messaging"
-	"log"
-	"math/rand"
+	"kitchen/internal/models"
+	"kitchen/internal/platform/dynconfig"
+	"kitchen/internal/platform/logging"
+	"kitchen/internal/repository"
+	"kitchen/internal/stations"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 )
 
+// minRetryBackoff and maxRetryBackoff bound the wait between attempts to
+// publish the outcome of a ticket.
+const (
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
+)
+
 type KitchenHandler struct {
 	queue *messaging.RabbitMQClient
+	repo  *repository.TicketRepository
+	line  *stations.Line
+
+	// config holds the settings that can change at runtime, such as whether
+	// tickets cook on their own.
+	config *dynconfig.Watcher[config.Config]
+	// spawn runs cooking and publish retries in the background, in a
+	// context that's cancelled on shutdown, which waits for them.
+	spawn func(task func(ctx context.Context))
+
+	mu      sync.Mutex
+	cooking map[int]*cookingJob
+
+	publishMu sync.Mutex
 }
 
-func NewKitchenHandler(rabbitmq *messaging.RabbitMQClient) *KitchenHandler {
-	return &KitchenHandler{queue: rabbitmq}
+type rejectTicketRequest struct {
+	Reason string `json:"reason"`
 }
 
-func (h *KitchenHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+func NewKitchenHandler(
+	rabbitmq *messaging.RabbitMQClient,
+	repo *repository.TicketRepository,
+	line *stations.Line,
+	config *dynconfig.Watcher[config.Config],
+	spawn func(task func(ctx context.Context)),
+) *KitchenHandler {
+	return &KitchenHandler{
+		queue:   rabbitmq,
+		repo:    repo,
+		line:    line,
+		config:  config,
+		spawn:   spawn,
+		cooking: make(map[int]*cookingJob),
+	}
 }
 
-func (h *KitchenHandler) HandleReadyForKitchen(ctx context.Context, orderID int32, items []*events.OrderItem) (bool, error) {
-	log.Printf("📦 Processing ready for kitchen event for order %d", orderID)
+// HandleListTickets lists the kitchen queue. It defaults to the queued and
+// cooking tickets; pass ?status=cooked,rejected to see others.
+func (h *KitchenHandler) HandleListTickets(w http.ResponseWriter, r *http.Request) {
+	statuses := []string{models.TicketStatusQueued, models.TicketStatusCooking}
+	if status := r.URL.Query().Get("status"); status != "" {
+		statuses = strings.Split(status, ",")
+	}
+
+	tickets, err := h.repo.ListTickets(r.Context(), statuses)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tickets)
+}
+
+func (h *KitchenHandler) HandleStartTicket(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	moved, err := h.repo.TransitionTicket(r.Context(), orderID, models.TicketStatusCooking, models.TicketStatusQueued)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if moved {
+		logging.Infof(r.Context(), "👩‍🍳 Order %d started by kitchen staff", orderID)
+	}
+
+	h.writeTicket(w, r, orderID, moved)
+}
+
+func (h *KitchenHandler) HandleCompleteTicket(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	moved, err := h.repo.TransitionTicket(r.Context(), orderID, models.TicketStatusCooked, models.TicketStatusQueued, models.TicketStatusCooking)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if moved {
+		logging.Infof(r.Context(), "✅ Order %d completed by kitchen staff", orderID)
+		h.stopCooking(orderID)
+		h.finishFromRequest(r.Context(), orderID, "kitchen.complete-ticket")
+	}
+
+	h.writeTicket(w, r, orderID, moved)
+}
+
+func (h *KitchenHandler) HandleRejectTicket(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	var req rejectTicketRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "rejected by kitchen staff"
+	}
+
+	moved, err := h.repo.RejectTicket(r.Context(), orderID, req.Reason)
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if moved {
+		logging.Warnf(r.Context(), "🚫 Order %d rejected by kitchen staff: %s", orderID, req.Reason)
+		h.stopCooking(orderID)
+		h.finishFromRequest(r.Context(), orderID, "kitchen.reject-ticket")
+	}
+
+	h.writeTicket(w, r, orderID, moved)
+}
+
+// HandleReadyForKitchen persists a queued ticket for the order before the
+// message is acked and returns when the order is estimated to be ready. In
+// auto-cook mode it then starts cooking it in the background.
+func (h *KitchenHandler) HandleReadyForKitchen(ctx context.Context, orderID int32, items []*events.OrderItem) (time.Time, error) {
+	logging.Infof(ctx, "📦 Processing ready for kitchen event for order %d", orderID)
 	// Get the incoming trace context
 	parentSpan := sentry.SpanFromContext(ctx)
 
-	go func() {
-		hub := sentry.GetHubFromContext(ctx)
-		if hub == nil {
-			hub = sentry.CurrentHub().Clone()
+	ticket := &models.Ticket{
+		OrderID:     int(orderID),
+		Status:      models.TicketStatusQueued,
+		SentryTrace: parentSpan.ToSentryTrace(),
+		Baggage:     parentSpan.ToBaggage(),
+		CreatedAt:   time.Now(),
+		Items:       make([]models.TicketItem, len(items)),
+	}
+	for i, item := range items {
+		ticket.Items[i] = models.TicketItem{
+			ProductID: int(item.Id),
+			Quantity:  int(item.Quantity),
 		}
-		goCtx := sentry.SetHubOnContext(context.Background(), hub)
-
-		cookingTx := sentry.StartTransaction(
-			goCtx,
-			"cooking",
-			sentry.ContinueFromHeaders(
-				parentSpan.ToSentryTrace(),
-				parentSpan.ToBaggage(),
-			),
-		)
-		cookingTx.Source = sentry.SourceTask
+	}
 
-		cookingTx.StartChild("mark", []sentry.SpanOption{
-			sentry.WithDescription(fmt.Sprintf("kitchen.started-cooking-%d", orderID)),
-		}...).Finish()
+	estimatedReadyAt, err := h.estimateReadyAt(ctx, ticket)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ticket.EstimatedReadyAt = &estimatedReadyAt
+
+	created, err := h.repo.CreateTicket(ctx, ticket)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !created {
+		logging.Infof(ctx, "♻️ Ticket for order %d already exists, skipping", orderID)
+		existing, err := h.repo.GetTicket(ctx, int(orderID))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if existing.EstimatedReadyAt != nil {
+			return *existing.EstimatedReadyAt, nil
+		}
+		return estimatedReadyAt, nil
+	}
+
+	if h.config.Current().AutoCook {
+		h.startCooking(ctx, ticket)
+	}
+
+	return estimatedReadyAt, nil
+}
+
+// estimateReadyAt estimates when a ticket will be cooked from the current
+// station queues and the historical cook durations of its products.
+func (h *KitchenHandler) estimateReadyAt(ctx context.Context, ticket *models.Ticket) (time.Time, error) {
+	productIDs := make([]int, len(ticket.Items))
+	for i, item := range ticket.Items {
+		productIDs[i] = item.ProductID
+	}
+
+	history, err := h.repo.AverageCookDurations(ctx, productIDs)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	readyIn := h.line.EstimateReadyIn(productIDs, history)
+
+	estimateSpan := sentry.SpanFromContext(ctx)
+	estimateSpan.SetData("kitchen.estimated_ready_in_ms", readyIn.Milliseconds())
+
+	return ticket.CreatedAt.Add(readyIn), nil
+}
+
+// ResumeTickets picks up the tickets a previous run of the service left
+// unfinished, so orders in flight during a restart still get cooked.
+func (h *KitchenHandler) ResumeTickets(ctx context.Context) error {
+	resumeTx := sentry.StartTransaction(ctx, "kitchen.resume-tickets")
+	resumeTx.Source = sentry.SourceTask
+	defer resumeTx.Finish()
+
+	tickets, err := h.repo.ListUnfinishedTickets(resumeTx.Context())
+	if err != nil {
+		return err
+	}
+
+	resumed := 0
+	for _, ticket := range tickets {
+		finished := ticket.Status == models.TicketStatusCooked || ticket.Status == models.TicketStatusRejected
+		if !finished && !h.config.Current().AutoCook {
+			continue
+		}
+
+		logging.Infof(ctx, "♻️ Resuming %s ticket for order %d", ticket.Status, ticket.OrderID)
+		h.startCooking(ctx, ticket)
+		resumed++
+	}
+
+	resumeTx.SetData("tickets.resumed", resumed)
+
+	return nil
+}
+
+// cookingJob is an order's auto-cook goroutine.
+type cookingJob struct {
+	cancel    context.CancelFunc
+	status    string
+	startedAt time.Time
+}
+
+func (h *KitchenHandler) startCooking(ctx context.Context, ticket *models.Ticket) {
+	cookCtx, cancel := context.WithCancel(context.Background())
+
+	h.mu.Lock()
+	h.cooking[ticket.OrderID] = &cookingJob{cancel: cancel, status: ticket.Status, startedAt: time.Now()}
+	h.mu.Unlock()
+
+	h.spawn(func(runCtx context.Context) {
+		// Shutdown stops the cooking too; the ticket is resumed on restart
+		stop := context.AfterFunc(runCtx, cancel)
+		defer func() {
+			stop()
+			h.mu.Lock()
+			delete(h.cooking, ticket.OrderID)
+			h.mu.Unlock()
+			cancel()
+		}()
+
+		h.cook(ctx, cookCtx, ticket)
+	})
+}
 
-		// Simulate cooking time
-		time.Sleep(time.Duration(rand.Intn(15000)+20000) * time.Millisecond)
+// stopCooking cancels the auto-cook goroutine of an order that kitchen staff
+// completed or rejected by hand.
+func (h *KitchenHandler) stopCooking(orderID int) {
+	h.mu.Lock()
+	job, ok := h.cooking[orderID]
+	h.mu.Unlock()
+
+	if ok {
+		job.cancel()
+	}
+}
+
+// CookingOrder describes an order whose auto-cook goroutine is running.
+type CookingOrder struct {
+	OrderID int `json:"order_id"`
+	// Status is the ticket's status when the goroutine started.
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+	Age       string    `json:"age"`
+}
+
+// Cooking returns the orders being cooked in the background, oldest first.
+func (h *KitchenHandler) Cooking() []CookingOrder {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	orders := make([]CookingOrder, 0, len(h.cooking))
+	for orderID, job := range h.cooking {
+		orders = append(orders, CookingOrder{
+			OrderID:   orderID,
+			Status:    job.status,
+			StartedAt: job.startedAt,
+			Age:       time.Since(job.startedAt).Round(time.Millisecond).String(),
+		})
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].StartedAt.Before(orders[j].StartedAt)
+	})
+
+	return orders
+}
+
+// cookAtStations splits the ticket by station and cooks every part at the
+// same time, each one waiting in its station's queue for a free slot first.
+func (h *KitchenHandler) cookAtStations(ctx context.Context, cookingTx *sentry.Span, ticket *models.Ticket) error {
+	var stationOrder []*stations.Station
+	stationItems := make(map[*stations.Station][]models.TicketItem)
+	for _, item := range ticket.Items {
+		station := h.line.StationFor(item.ProductID)
+		if _, ok := stationItems[station]; !ok {
+			stationOrder = append(stationOrder, station)
+		}
+		stationItems[station] = append(stationItems[station], item)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		startOnce sync.Once
+		errOnce   sync.Once
+		cookErr   error
+	)
+
+	for _, station := range stationOrder {
+		wg.Add(1)
+		go func(station *stations.Station, items []models.TicketItem) {
+			defer wg.Done()
+
+			waitSpan := cookingTx.StartChild("queue.wait", []sentry.SpanOption{
+				sentry.WithDescription(fmt.Sprintf("kitchen.waiting-for-%s", station.Name)),
+			}...)
+			waitSpan.SetData("kitchen.station", station.Name)
+			waitSpan.SetData("kitchen.station.concurrency", station.Concurrency)
+			waitSpan.SetData("kitchen.station.queue_depth", station.QueueDepth())
+			err := station.Acquire(ctx)
+			waitSpan.Finish()
+			if err != nil {
+				errOnce.Do(func() { cookErr = err })
+				return
+			}
+			defer station.Release()
+
+			startOnce.Do(func() {
+				_, err := h.repo.TransitionTicket(cookingTx.Context(), ticket.OrderID, models.TicketStatusCooking, models.TicketStatusQueued)
+				if err != nil {
+					errOnce.Do(func() { cookErr = err })
+				}
+
+				cookingTx.StartChild("mark", []sentry.SpanOption{
+					sentry.WithDescription(fmt.Sprintf("kitchen.started-cooking-%d", ticket.OrderID)),
+				}...).Finish()
+			})
+
+			cookSpan := cookingTx.StartChild("function", []sentry.SpanOption{
+				sentry.WithDescription(fmt.Sprintf("kitchen.cooking-%s", station.Name)),
+			}...)
+			cookSpan.SetData("kitchen.station", station.Name)
+			cookSpan.SetData("kitchen.items", len(items))
+			startedAt := time.Now()
+			// Simulate cooking time
+			timer := time.NewTimer(station.CookTime())
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				errOnce.Do(func() { cookErr = ctx.Err() })
+				cookSpan.Finish()
+				return
+			}
+			cookSpan.Finish()
+
+			productIDs := make([]int, len(items))
+			for i, item := range items {
+				productIDs[i] = item.ProductID
+			}
+			err = h.repo.RecordCookDurations(cookingTx.Context(), ticket.ID, productIDs, time.Since(startedAt))
+			if err != nil {
+				logging.Errorf(ctx, "❌ Failed to record cook durations for order %d: %v", ticket.OrderID, err)
+			}
+		}(station, stationItems[station])
+	}
+
+	wg.Wait()
+
+	return cookErr
+}
+
+func (h *KitchenHandler) cook(ctx context.Context, cookCtx context.Context, ticket *models.Ticket) {
+	cookingTx := h.ticketTransaction(ctx, ticket, "cooking")
+	defer cookingTx.Finish()
+	cookingCtx := cookingTx.Context()
+
+	if ticket.Status == models.TicketStatusQueued || ticket.Status == models.TicketStatusCooking {
+		err := h.cookAtStations(cookCtx, cookingTx, ticket)
+		if errors.Is(err, context.Canceled) {
+			logging.Infof(ctx, "✋ Stopped cooking order %d", ticket.OrderID)
+			return
+		}
+		if err != nil {
+			logging.Errorf(ctx, "❌ Failed to cook order %d: %v", ticket.OrderID, err)
+			sentry.CaptureException(err)
+			return
+		}
 
 		cookingTx.StartChild("mark", []sentry.SpanOption{
-			sentry.WithDescription(fmt.Sprintf("kitchen.finished-cooking-%d", orderID)),
+			sentry.WithDescription(fmt.Sprintf("kitchen.finished-cooking-%d", ticket.OrderID)),
 		}...).Finish()
 
-		log.Printf("✅ Order %d cooked", orderID)
-
-		// Publish the cooked event using the cooking finish transaction's context
-		err := h.queue.PublishOrderCooked(cookingTx.Context(), orderID, items)
+		moved, err := h.repo.TransitionTicket(cookingCtx, ticket.OrderID, models.TicketStatusCooked, models.TicketStatusCooking)
 		if err != nil {
-			log.Printf("❌ AMQP: Failed to publish order cooked event: %v", err)
-			cookingTx.Finish()
+			logging.Errorf(ctx, "❌ Failed to mark order %d as cooked: %v", ticket.OrderID, err)
+			sentry.CaptureException(err)
 			return
 		}
+		if !moved {
+			// Kitchen staff completed or rejected it while it was cooking
+			return
+		}
+
+		logging.Infof(ctx, "✅ Order %d cooked", ticket.OrderID)
+	}
+
+	h.announce(cookingCtx, ticket.OrderID)
+}
+
+// finishFromRequest publishes the outcome of a ticket completed or rejected
+// over HTTP, continuing the order's trace rather than the request's.
+func (h *KitchenHandler) finishFromRequest(ctx context.Context, orderID int, name string) {
+	ticket, err := h.repo.GetTicket(ctx, orderID)
+	if err != nil {
+		logging.Errorf(ctx, "❌ Failed to load ticket for order %d: %v", orderID, err)
+		sentry.CaptureException(err)
+		return
+	}
+
+	tx := h.ticketTransaction(ctx, ticket, name)
+	defer tx.Finish()
+
+	h.announce(tx.Context(), orderID)
+}
+
+// announce publishes the outcome of a ticket. If that fails, it keeps
+// trying in the background, backing off between attempts, so the order
+// isn't left waiting until the next restart. A retry still pending at
+// shutdown is left to ResumeTickets.
+func (h *KitchenHandler) announce(ctx context.Context, orderID int) {
+	err := h.publishOutcome(ctx, orderID)
+	if err == nil {
+		return
+	}
+	logging.Errorf(ctx, "❌ Failed to publish outcome of order %d, retrying in %s: %v", orderID, minRetryBackoff, err)
+	sentry.CaptureException(err)
+
+	// The request or message that finished the ticket is done by now
+	ctx = context.WithoutCancel(ctx)
+	h.spawn(func(runCtx context.Context) {
+		backoff := minRetryBackoff
+		for attempt := 2; ; attempt++ {
+			select {
+			case <-time.After(backoff):
+			case <-runCtx.Done():
+				return
+			}
+
+			err := h.publishOutcome(ctx, orderID)
+			if err == nil {
+				logging.Infof(ctx, "✅ Published outcome of order %d on attempt %d", orderID, attempt)
+				return
+			}
+
+			backoff = min(backoff*2, maxRetryBackoff)
+			logging.Warnf(ctx, "⚠️ Failed to publish outcome of order %d (attempt %d), retrying in %s: %v", orderID, attempt, backoff, err)
+		}
+	})
+}
 
-		log.Printf("✅ AMQP: Order cooked event published for order %d", orderID)
-		cookingTx.Finish()
-	}()
+// publishOutcome announces a cooked or rejected ticket. It reads the ticket
+// back from the database, so only persisted outcomes are ever published, and
+// marks it as published so it's announced once.
+func (h *KitchenHandler) publishOutcome(ctx context.Context, orderID int) error {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	ticket, err := h.repo.GetTicket(ctx, orderID)
+	if err != nil {
+		sentry.CaptureException(err)
+		return err
+	}
+
+	if ticket.PublishedAt != nil {
+		return nil
+	}
+
+	switch ticket.Status {
+	case models.TicketStatusCooked:
+		items := make([]*events.OrderItem, len(ticket.Items))
+		for i, item := range ticket.Items {
+			items[i] = &events.OrderItem{
+				Id:       int32(item.ProductID),
+				Quantity: int32(item.Quantity),
+			}
+		}
+		err = h.queue.PublishOrderCooked(ctx, int32(ticket.OrderID), items)
+	case models.TicketStatusRejected:
+		err = h.queue.PublishKitchenRejected(ctx, int32(ticket.OrderID), ticket.RejectionReason)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = h.repo.MarkTicketPublished(ctx, ticket.OrderID)
+	if err != nil {
+		sentry.CaptureException(err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *KitchenHandler) ticketTransaction(ctx context.Context, ticket *models.Ticket, name string) *sentry.Span {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+	}
+	goCtx := logging.WithOrderID(sentry.SetHubOnContext(context.Background(), hub), ticket.OrderID)
+
+	tx := sentry.StartTransaction(
+		goCtx,
+		name,
+		sentry.ContinueFromHeaders(ticket.SentryTrace, ticket.Baggage),
+	)
+	tx.Source = sentry.SourceTask
+	tx.SetData("order.id", ticket.OrderID)
+
+	return tx
+}
+
+// writeTicket responds with the current state of a ticket, or with a
+// conflict when the requested transition wasn't allowed.
+func (h *KitchenHandler) writeTicket(w http.ResponseWriter, r *http.Request, orderID int, moved bool) {
+	ticket, err := h.repo.GetTicket(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("no ticket for order %d", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !moved {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(ticket)
+}
 
-	return true, nil
+func parseOrderID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	orderID, err := strconv.Atoi(r.PathValue("orderId"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return 0, false
+	}
+	return orderID, true
 }
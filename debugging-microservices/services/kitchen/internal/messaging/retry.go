@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"fmt"
+	"kitchen/internal/platform/amqptrace"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// RetryExchange takes the messages a consumer failed to process to the
+	// retry queue of the queue named in their amqptrace.RetryQueueHeader.
+	RetryExchange = "order_events.retry"
+	// RetriedExchange takes them from there back to that queue. Both match on
+	// the header, so a retried message keeps its routing key and no other
+	// queue gets it again.
+	RetriedExchange = "order_events.retried"
+)
+
+// retryDelay is how long a message waits in the retry queue before it's
+// tried again. Changing it means deleting the retry queues, as the broker
+// refuses to redeclare them with another TTL.
+const retryDelay = 5 * time.Second
+
+// RetryQueue is the queue messages from queue wait in to be tried again.
+func RetryQueue(queue string) string {
+	return queue + ".retry"
+}
+
+// declareRetryQueue declares the retry queue of queue and routes the
+// messages from it back to queue. It returns where a consumer of queue
+// sends the messages to be tried again.
+func declareRetryQueue(ch *amqp.Channel, queue string) (amqptrace.Retry, error) {
+	for _, exchange := range []string{RetryExchange, RetriedExchange} {
+		err := ch.ExchangeDeclare(
+			exchange,
+			"headers",
+			true,  // durable
+			false, // auto-deleted
+			false, // internal
+			false, // no-wait
+			nil,   // arguments
+		)
+		if err != nil {
+			return amqptrace.Retry{}, fmt.Errorf("❌ AMQP: Failed to declare retry exchange: %v", err)
+		}
+	}
+
+	retryQueue := RetryQueue(queue)
+	_, err := ch.QueueDeclare(
+		retryQueue,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			"x-message-ttl":          retryDelay.Milliseconds(),
+			"x-dead-letter-exchange": RetriedExchange,
+		},
+	)
+	if err != nil {
+		return amqptrace.Retry{}, fmt.Errorf("❌ AMQP: Failed to declare retry queue: %v", err)
+	}
+
+	binding := amqp.Table{
+		"x-match":                  "all",
+		amqptrace.RetryQueueHeader: queue,
+	}
+	err = ch.QueueBind(retryQueue, "", RetryExchange, false, binding)
+	if err == nil {
+		err = ch.QueueBind(queue, "", RetriedExchange, false, binding)
+	}
+	if err != nil {
+		return amqptrace.Retry{}, fmt.Errorf("❌ AMQP: Failed to bind retry queue: %v", err)
+	}
+
+	return amqptrace.Retry{Channel: ch, Exchange: RetryExchange, Queue: queue}, nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	TicketStatusQueued   = "queued"
+	TicketStatusCooking  = "cooking"
+	TicketStatusCooked   = "cooked"
+	TicketStatusRejected = "rejected"
+)
+
+type Ticket struct {
+	ID               int        `db:"id"`
+	OrderID          int        `db:"order_id"`
+	Status           string     `db:"status"` // queued, cooking, cooked, rejected
+	RejectionReason  string     `db:"rejection_reason"`
+	SentryTrace      string     `db:"sentry_trace"`
+	Baggage          string     `db:"baggage"`
+	CreatedAt        time.Time  `db:"created_at"`
+	EstimatedReadyAt *time.Time `db:"estimated_ready_at"`
+	StartedAt        *time.Time `db:"started_at"`
+	CookedAt         *time.Time `db:"cooked_at"`
+	PublishedAt      *time.Time `db:"published_at"`
+	Items            []TicketItem
+}
+
+type TicketItem struct {
+	ID             int  `db:"id"`
+	TicketID       int  `db:"ticket_id"`
+	ProductID      int  `db:"product_id"`
+	Quantity       int  `db:"quantity"`
+	CookDurationMs *int `db:"cook_duration_ms"`
+}
@@ -0,0 +1,666 @@
+// Package amqpfake is an in-process AMQP broker for tests. Its Channel has
+// the methods of *amqp.Channel the services use and behaves like RabbitMQ
+// where they rely on it: direct, fanout, topic and headers exchanges,
+// requeued messages going back to their place in the queue, publisher
+// confirms, max-length overflow, and dead-lettering of rejected and expired
+// messages with the x-death header. Time only passes when Advance is called,
+// so TTLs expire on cue.
+package amqpfake
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Broker holds the exchanges and queues its channels share.
+type Broker struct {
+	mu        sync.Mutex
+	now       time.Time
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+	nextSeq   uint64
+}
+
+type exchange struct {
+	kind     string
+	bindings []binding
+}
+
+type binding struct {
+	queue string
+	key   string
+	args  amqp.Table
+}
+
+type queue struct {
+	args amqp.Table
+	// messages are ready to deliver, in order.
+	messages []*message
+}
+
+type message struct {
+	// seq is the order the message was enqueued in, which a requeue keeps.
+	seq         uint64
+	exchange    string
+	routingKey  string
+	publishing  amqp.Publishing
+	redelivered bool
+	enqueuedAt  time.Time
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		// AMQP timestamps only have second precision.
+		now:       time.Now().UTC().Truncate(time.Second),
+		exchanges: map[string]*exchange{},
+		queues:    map[string]*queue{},
+	}
+}
+
+// Now is the broker's clock, which only moves with Advance.
+func (b *Broker) Now() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.now
+}
+
+// Advance moves the clock by d and expires the messages whose queue's
+// x-message-ttl has run out, dead-lettering them.
+func (b *Broker) Advance(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = b.now.Add(d)
+
+	// Expiring a message may dead-letter it into another queue with a TTL,
+	// where it starts waiting afresh.
+	names := make([]string, 0, len(b.queues))
+	for name := range b.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		q := b.queues[name]
+		ttl, ok := intArg(q.args["x-message-ttl"])
+		if !ok {
+			continue
+		}
+		for len(q.messages) > 0 && !b.now.Before(q.messages[0].enqueuedAt.Add(time.Duration(ttl)*time.Millisecond)) {
+			expired := q.messages[0]
+			q.messages = q.messages[1:]
+			b.deadLetter(name, expired, "expired")
+		}
+	}
+}
+
+// Messages returns the messages ready in queue, in the order they'll be
+// delivered, without delivering them.
+func (b *Broker) Messages(queue string) []amqp.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil
+	}
+	deliveries := make([]amqp.Delivery, len(q.messages))
+	for i, m := range q.messages {
+		deliveries[i] = m.delivery()
+	}
+	return deliveries
+}
+
+func (m *message) delivery() amqp.Delivery {
+	headers := amqp.Table{}
+	for key, value := range m.publishing.Headers {
+		headers[key] = value
+	}
+	return amqp.Delivery{
+		Headers:         headers,
+		ContentType:     m.publishing.ContentType,
+		ContentEncoding: m.publishing.ContentEncoding,
+		DeliveryMode:    m.publishing.DeliveryMode,
+		Priority:        m.publishing.Priority,
+		CorrelationId:   m.publishing.CorrelationId,
+		ReplyTo:         m.publishing.ReplyTo,
+		Expiration:      m.publishing.Expiration,
+		MessageId:       m.publishing.MessageId,
+		Timestamp:       m.publishing.Timestamp,
+		Type:            m.publishing.Type,
+		UserId:          m.publishing.UserId,
+		AppId:           m.publishing.AppId,
+		Body:            m.publishing.Body,
+		Exchange:        m.exchange,
+		RoutingKey:      m.routingKey,
+		Redelivered:     m.redelivered,
+	}
+}
+
+// publish routes a message and reports whether every queue it was routed to
+// took it. Unroutable messages are dropped, and confirmed all the same.
+func (b *Broker) publish(exchangeName, key string, msg amqp.Publishing) (bool, error) {
+	queues, err := b.route(exchangeName, key, msg.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	msg.Headers = headers
+
+	acked := true
+	for _, name := range queues {
+		b.nextSeq++
+		if !b.enqueue(name, &message{
+			seq:        b.nextSeq,
+			exchange:   exchangeName,
+			routingKey: key,
+			publishing: msg,
+			enqueuedAt: b.now,
+		}) {
+			acked = false
+		}
+	}
+	return acked, nil
+}
+
+// route returns the queues a message published to exchangeName goes to.
+func (b *Broker) route(exchangeName, key string, headers amqp.Table) ([]string, error) {
+	// The default exchange routes to the queue named by the key.
+	if exchangeName == "" {
+		if _, ok := b.queues[key]; ok {
+			return []string{key}, nil
+		}
+		return nil, nil
+	}
+
+	e, ok := b.exchanges[exchangeName]
+	if !ok {
+		return nil, &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no exchange '%s'", exchangeName)}
+	}
+
+	var queues []string
+	seen := map[string]bool{}
+	for _, bound := range e.bindings {
+		if seen[bound.queue] || !bound.matches(e.kind, key, headers) {
+			continue
+		}
+		seen[bound.queue] = true
+		queues = append(queues, bound.queue)
+	}
+	return queues, nil
+}
+
+func (bound binding) matches(kind, key string, headers amqp.Table) bool {
+	switch kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return topicMatches(strings.Split(bound.key, "."), strings.Split(key, "."))
+	case amqp.ExchangeHeaders:
+		return headersMatch(bound.args, headers)
+	default:
+		return bound.key == key
+	}
+}
+
+// topicMatches matches the words of a routing key against a binding
+// pattern, where * is one word and # is any number of them.
+func topicMatches(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatches(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatches(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && topicMatches(pattern[1:], words[1:])
+	}
+}
+
+// headersMatch matches message headers against binding arguments. As in
+// RabbitMQ, arguments starting with x- aren't matched on, x-match is all
+// unless it's any, and a binding with nothing to match on matches
+// everything.
+func headersMatch(args, headers amqp.Table) bool {
+	matchAny := args["x-match"] == "any"
+	matched := 0
+	criteria := 0
+	for key, want := range args {
+		if strings.HasPrefix(key, "x-") {
+			continue
+		}
+		criteria++
+		if got, ok := headers[key]; ok && reflect.DeepEqual(got, want) {
+			matched++
+		}
+	}
+	if criteria == 0 {
+		return true
+	}
+	if matchAny {
+		return matched > 0
+	}
+	return matched == criteria
+}
+
+// enqueue adds m to the end of queue, unless x-max-length is reached. Then
+// an x-overflow of reject-publish refuses m and anything else drops the
+// oldest message, dead-lettering it.
+func (b *Broker) enqueue(name string, m *message) bool {
+	q := b.queues[name]
+	if max, ok := intArg(q.args["x-max-length"]); ok && int64(len(q.messages)) >= max {
+		if q.args["x-overflow"] == "reject-publish" {
+			return false
+		}
+		if len(q.messages) == 0 {
+			b.deadLetter(name, m, "maxlen")
+			return true
+		}
+		dropped := q.messages[0]
+		q.messages = q.messages[1:]
+		b.deadLetter(name, dropped, "maxlen")
+	}
+	q.messages = append(q.messages, m)
+	return true
+}
+
+// requeue puts m back in queue where it was, ahead of everything enqueued
+// after it.
+func (b *Broker) requeue(name string, m *message) {
+	q, ok := b.queues[name]
+	if !ok {
+		return
+	}
+	m.redelivered = true
+	i := sort.Search(len(q.messages), func(i int) bool { return q.messages[i].seq > m.seq })
+	q.messages = append(q.messages, nil)
+	copy(q.messages[i+1:], q.messages[i:])
+	q.messages[i] = m
+}
+
+// deadLetter republishes m, taken from queue for reason, to the queue's
+// x-dead-letter-exchange, with x-dead-letter-routing-key if it's set. The
+// x-death entry for the queue and reason counts one more death and moves to
+// the front. Without a dead-letter exchange m is dropped.
+func (b *Broker) deadLetter(name string, m *message, reason string) {
+	args := b.queues[name].args
+	dlx, ok := args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	key := m.routingKey
+	if dlk, ok := args["x-dead-letter-routing-key"].(string); ok {
+		key = dlk
+	}
+
+	headers := amqp.Table{}
+	for k, v := range m.publishing.Headers {
+		headers[k] = v
+	}
+	deaths, _ := headers["x-death"].([]interface{})
+	death := amqp.Table{
+		"count":        int64(1),
+		"reason":       reason,
+		"queue":        name,
+		"time":         b.now,
+		"exchange":     m.exchange,
+		"routing-keys": []interface{}{m.routingKey},
+	}
+	others := []interface{}{}
+	for _, d := range deaths {
+		if previous, ok := d.(amqp.Table); ok && previous["queue"] == name && previous["reason"] == reason {
+			count, _ := previous["count"].(int64)
+			death["count"] = count + 1
+			continue
+		}
+		others = append(others, d)
+	}
+	headers["x-death"] = append([]interface{}{death}, others...)
+	if _, ok := headers["x-first-death-queue"]; !ok {
+		headers["x-first-death-queue"] = name
+		headers["x-first-death-reason"] = reason
+		headers["x-first-death-exchange"] = m.exchange
+	}
+
+	publishing := m.publishing
+	publishing.Headers = headers
+	publishing.Expiration = ""
+	// A dead-letter exchange that's gone drops the message.
+	b.publish(dlx, key, publishing)
+}
+
+func intArg(value interface{}) (int64, bool) {
+	switch n := value.(type) {
+	case int:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// Channel is a channel on a Broker. Messages taken from it stay unacked
+// until they're acked, nacked or rejected, or the channel closes, which
+// requeues them. Like a real channel, it closes on a channel error, such as
+// publishing to a missing exchange, and fails with amqp.ErrClosed after.
+type Channel struct {
+	broker  *Broker
+	closed  bool
+	confirm bool
+	nextTag uint64
+	unacked map[uint64]unacked
+}
+
+type unacked struct {
+	queue   string
+	message *message
+}
+
+// Channel opens a channel on b.
+func (b *Broker) Channel() *Channel {
+	return &Channel{broker: b, unacked: map[uint64]unacked{}}
+}
+
+// fail closes the channel on a channel error and returns it.
+func (c *Channel) fail(err error) error {
+	c.close()
+	return err
+}
+
+func (c *Channel) close() {
+	c.closed = true
+	tags := make([]uint64, 0, len(c.unacked))
+	for tag := range c.unacked {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	for _, tag := range tags {
+		c.broker.requeue(c.unacked[tag].queue, c.unacked[tag].message)
+	}
+	c.unacked = map[uint64]unacked{}
+}
+
+// Close closes the channel, requeueing the messages left unacked.
+func (c *Channel) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.close()
+	return nil
+}
+
+// Unacked is how many messages taken from the channel are still unacked.
+func (c *Channel) Unacked() int {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return len(c.unacked)
+}
+
+func (c *Channel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+
+	if e, ok := c.broker.exchanges[name]; ok {
+		if e.kind != kind {
+			return c.fail(&amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("PRECONDITION_FAILED - inequivalent arg 'type' for exchange '%s'", name)})
+		}
+		return nil
+	}
+	c.broker.exchanges[name] = &exchange{kind: kind}
+	return nil
+}
+
+// ExchangeDelete deletes the exchange and its bindings. Publishing to it
+// afterwards is a channel error.
+func (c *Channel) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+
+	if _, ok := c.broker.exchanges[name]; !ok {
+		return c.fail(&amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no exchange '%s'", name)})
+	}
+	delete(c.broker.exchanges, name)
+	return nil
+}
+
+func (c *Channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+
+	if q, ok := c.broker.queues[name]; ok {
+		for _, key := range argKeys(q.args, args) {
+			if fmt.Sprint(q.args[key]) != fmt.Sprint(args[key]) {
+				return amqp.Queue{}, c.fail(&amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("PRECONDITION_FAILED - inequivalent arg '%s' for queue '%s'", key, name)})
+			}
+		}
+		return amqp.Queue{Name: name, Messages: len(q.messages)}, nil
+	}
+
+	copied := amqp.Table{}
+	for key, value := range args {
+		copied[key] = value
+	}
+	c.broker.queues[name] = &queue{args: copied}
+	return amqp.Queue{Name: name}, nil
+}
+
+func argKeys(tables ...amqp.Table) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, table := range tables {
+		for key := range table {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func (c *Channel) QueueBind(name, key, exchangeName string, noWait bool, args amqp.Table) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+
+	e, ok := c.broker.exchanges[exchangeName]
+	if !ok {
+		return c.fail(&amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no exchange '%s'", exchangeName)})
+	}
+	if _, ok := c.broker.queues[name]; !ok {
+		return c.fail(&amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no queue '%s'", name)})
+	}
+
+	for _, bound := range e.bindings {
+		if bound.queue == name && bound.key == key && fmt.Sprint(bound.args) == fmt.Sprint(args) {
+			return nil
+		}
+	}
+	e.bindings = append(e.bindings, binding{queue: name, key: key, args: args})
+	return nil
+}
+
+// QueuePurge drops the messages ready in the queue, but not the unacked
+// ones, and returns how many it dropped.
+func (c *Channel) QueuePurge(name string, noWait bool) (int, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return 0, amqp.ErrClosed
+	}
+
+	q, ok := c.broker.queues[name]
+	if !ok {
+		return 0, c.fail(&amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no queue '%s'", name)})
+	}
+	purged := len(q.messages)
+	q.messages = nil
+	return purged, nil
+}
+
+// Confirm puts the channel in confirm mode.
+func (c *Channel) Confirm(noWait bool) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.confirm = true
+	return nil
+}
+
+func (c *Channel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	_, err := c.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	return err
+}
+
+// PublishWithDeferredConfirmWithContext publishes msg and, in confirm mode,
+// returns the broker's confirmation: a nack if a queue it was routed to
+// refused it. Outside confirm mode the confirmation is nil.
+func (c *Channel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*Confirmation, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	acked, err := c.broker.publish(exchange, key, msg)
+	if err != nil {
+		return nil, c.fail(err)
+	}
+	if !c.confirm {
+		return nil, nil
+	}
+	return &Confirmation{acked: acked}, nil
+}
+
+// Get takes the next message from queue, if there is one.
+func (c *Channel) Get(name string, autoAck bool) (amqp.Delivery, bool, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.Delivery{}, false, amqp.ErrClosed
+	}
+
+	q, ok := c.broker.queues[name]
+	if !ok {
+		return amqp.Delivery{}, false, c.fail(&amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no queue '%s'", name)})
+	}
+	if len(q.messages) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+	m := q.messages[0]
+	q.messages = q.messages[1:]
+
+	c.nextTag++
+	delivery := m.delivery()
+	delivery.DeliveryTag = c.nextTag
+	if !autoAck {
+		delivery.Acknowledger = c
+		c.unacked[c.nextTag] = unacked{queue: name, message: m}
+	}
+	return delivery, true, nil
+}
+
+// settle settles the message with tag, or every unacked one up to it if
+// multiple. An unknown tag is a channel error, as with RabbitMQ.
+func (c *Channel) settle(tag uint64, multiple bool, settle func(unacked)) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+
+	if _, ok := c.unacked[tag]; !ok {
+		return c.fail(&amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("PRECONDITION_FAILED - unknown delivery tag %d", tag)})
+	}
+
+	tags := []uint64{tag}
+	if multiple {
+		tags = tags[:0]
+		for t := range c.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	}
+	for _, t := range tags {
+		settle(c.unacked[t])
+		delete(c.unacked, t)
+	}
+	return nil
+}
+
+func (c *Channel) Ack(tag uint64, multiple bool) error {
+	return c.settle(tag, multiple, func(unacked) {})
+}
+
+// Nack requeues the message to where it was in its queue, or dead-letters
+// it.
+func (c *Channel) Nack(tag uint64, multiple, requeue bool) error {
+	return c.settle(tag, multiple, func(u unacked) {
+		if requeue {
+			c.broker.requeue(u.queue, u.message)
+			return
+		}
+		if _, ok := c.broker.queues[u.queue]; ok {
+			c.broker.deadLetter(u.queue, u.message, "rejected")
+		}
+	})
+}
+
+func (c *Channel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+// Confirmation is the broker's answer to a publish in confirm mode, as with
+// *amqp.DeferredConfirmation. The fake answers straight away.
+type Confirmation struct {
+	acked bool
+}
+
+func (c *Confirmation) Acked() bool {
+	return c.acked
+}
+
+func (c *Confirmation) Wait() bool {
+	return c.acked
+}
+
+func (c *Confirmation) WaitContext(ctx context.Context) (bool, error) {
+	return c.acked, nil
+}
@@ -0,0 +1,142 @@
+package amqptrace
+
+import (
+	"context"
+	"errors"
+	"kitchen/internal/platform/amqpfake"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	testQueue = "test_events"
+	testKey   = "order.created"
+)
+
+// newBroker declares testQueue bound to events with testKey, dead-lettered
+// to testQueue.dlq and retried through a retry queue, as the services
+// declare theirs.
+func newBroker(t *testing.T) (*amqpfake.Broker, *amqpfake.Channel) {
+	t.Helper()
+
+	broker := amqpfake.NewBroker()
+	ch := broker.Channel()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("declaring the topology: %v", err)
+		}
+	}
+	must(ch.ExchangeDeclare("events", amqp.ExchangeTopic, true, false, false, false, nil))
+	must(ch.ExchangeDeclare("events.dlx", amqp.ExchangeDirect, true, false, false, false, nil))
+	must(ch.ExchangeDeclare("events.retry", amqp.ExchangeHeaders, true, false, false, false, nil))
+	must(ch.ExchangeDeclare("events.retried", amqp.ExchangeHeaders, true, false, false, false, nil))
+
+	_, err := ch.QueueDeclare(testQueue+".dlq", true, false, false, false, nil)
+	must(err)
+	must(ch.QueueBind(testQueue+".dlq", testQueue+".dlq", "events.dlx", false, nil))
+
+	_, err = ch.QueueDeclare(testQueue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "events.dlx",
+		"x-dead-letter-routing-key": testQueue + ".dlq",
+	})
+	must(err)
+	must(ch.QueueBind(testQueue, testKey, "events", false, nil))
+
+	_, err = ch.QueueDeclare(testQueue+".retry", true, false, false, false, amqp.Table{
+		"x-message-ttl":          int64(5000),
+		"x-dead-letter-exchange": "events.retried",
+	})
+	must(err)
+	binding := amqp.Table{"x-match": "all", RetryQueueHeader: testQueue}
+	must(ch.QueueBind(testQueue+".retry", "", "events.retry", false, binding))
+	must(ch.QueueBind(testQueue, "", "events.retried", false, binding))
+
+	return broker, ch
+}
+
+func TestProcessRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures is how many times the handler fails before it succeeds, or
+		// -1 if it never does.
+		failures int
+		err      error
+		// attempts is how many times the handler runs.
+		attempts int
+		// deadLettered is whether the message ends up in the dead-letter
+		// queue, after this many redeliveries.
+		deadLettered bool
+		redeliveries int64
+	}{
+		{name: "succeeds", failures: 0, attempts: 1},
+		{name: "succeeds on a retry", failures: 2, err: errors.New("database is down"), attempts: 3},
+		{
+			name: "keeps failing", failures: -1, err: errors.New("database is down"),
+			attempts: MaxRedeliveries + 1, deadLettered: true, redeliveries: MaxRedeliveries,
+		},
+		{
+			name: "rejected", failures: -1, err: Reject(errors.New("can't decode")),
+			attempts: 1, deadLettered: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, ch := newBroker(t)
+			consumer := NewConsumer("test", Retry{Channel: ch, Exchange: "events.retry", Queue: testQueue})
+
+			attempts := 0
+			consumer.Handle(testKey, func(ctx context.Context, msg *amqp.Delivery) error {
+				attempts++
+				if tt.failures >= 0 && attempts > tt.failures {
+					return nil
+				}
+				return tt.err
+			})
+
+			ctx := context.Background()
+			if err := ch.PublishWithContext(ctx, "events", testKey, false, false, amqp.Publishing{MessageId: "1"}); err != nil {
+				t.Fatalf("publishing: %v", err)
+			}
+			for {
+				msg, ok, err := ch.Get(testQueue, false)
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				if !ok {
+					break
+				}
+				if msg.RoutingKey != testKey {
+					t.Errorf("attempt %d has routing key %q, want %q", attempts+1, msg.RoutingKey, testKey)
+				}
+				consumer.Process(ctx, msg)
+				// Nothing's tried again before the retry delay.
+				if queued := broker.Messages(testQueue); len(queued) != 0 {
+					t.Fatalf("%d messages back in the queue straight away", len(queued))
+				}
+				broker.Advance(time.Minute)
+			}
+
+			if attempts != tt.attempts {
+				t.Errorf("handler ran %d times, want %d", attempts, tt.attempts)
+			}
+			if ch.Unacked() != 0 {
+				t.Errorf("%d messages left unacked", ch.Unacked())
+			}
+
+			deadLetters := broker.Messages(testQueue + ".dlq")
+			if (len(deadLetters) > 0) != tt.deadLettered {
+				t.Fatalf("dead-lettered %d messages, want dead-lettered %t", len(deadLetters), tt.deadLettered)
+			}
+			if tt.deadLettered {
+				if got := redeliveries(&deadLetters[0]); got != tt.redeliveries {
+					t.Errorf("dead-lettered after %d redeliveries, want %d", got, tt.redeliveries)
+				}
+			}
+		})
+	}
+}
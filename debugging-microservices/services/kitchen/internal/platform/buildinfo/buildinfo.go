@@ -0,0 +1,78 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// Version can be stamped at build time with
+//
+//	-ldflags "-X <module>/internal/platform/buildinfo.Version=1.2.3"
+//
+// Otherwise it falls back to the module version, then the VCS revision.
+var Version = ""
+
+// Info describes the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Read returns the build information embedded in the binary.
+func Read() Info {
+	once.Do(func() {
+		info = read()
+	})
+	return info
+}
+
+func read() Info {
+	result := Info{Version: Version}
+
+	build, ok := debug.ReadBuildInfo()
+	if ok {
+		result.GoVersion = build.GoVersion
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				result.Revision = setting.Value
+			case "vcs.time":
+				result.Time = setting.Value
+			case "vcs.modified":
+				result.Modified = setting.Value == "true"
+			}
+		}
+
+		if result.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			result.Version = build.Main.Version
+		}
+	}
+
+	if result.Version == "" && result.Revision != "" {
+		result.Version = shortRevision(result.Revision)
+		if result.Modified {
+			result.Version += "-dirty"
+		}
+	}
+
+	if result.Version == "" {
+		result.Version = "dev"
+	}
+
+	return result
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
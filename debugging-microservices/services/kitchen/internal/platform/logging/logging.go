@@ -0,0 +1,121 @@
+// Package logging writes JSON logs through log/slog. Every line carries the
+// service name and, when ctx has them, the trace_id, span_id, order_id and
+// routing_key of the work it belongs to, so it can be joined to its trace.
+// Errors are also added to Sentry as breadcrumbs, so an issue shows the
+// failures that led up to it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Level is the minimum level logged. It can be changed at runtime.
+var Level = new(slog.LevelVar)
+
+// Setup makes slog's default logger write JSON to stdout at the level in
+// LOG_LEVEL (debug, info, warn or error; info by default). The standard
+// log package goes through it too, at info level.
+func Setup(service string) error {
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := Level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("❌ Invalid LOG_LEVEL %q: %w", value, err)
+		}
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: Level})
+	logger := slog.New(&contextHandler{Handler: handler}).With("service", service)
+	slog.SetDefault(logger)
+
+	return nil
+}
+
+// Debugf, Infof, Warnf and Errorf log a formatted message with the fields
+// found in ctx. Errors among args are also added as an "error" attribute.
+func Debugf(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelDebug, format, args)
+}
+
+func Infof(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelInfo, format, args)
+}
+
+func Warnf(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelWarn, format, args)
+}
+
+func Errorf(ctx context.Context, format string, args ...interface{}) {
+	logf(ctx, slog.LevelError, format, args)
+}
+
+func logf(ctx context.Context, level slog.Level, format string, args []interface{}) {
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	var attrs []slog.Attr
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			attrs = append(attrs, slog.String("error", err.Error()))
+			break
+		}
+	}
+
+	logger.LogAttrs(ctx, level, fmt.Sprintf(format, args...), attrs...)
+}
+
+// contextHandler adds the fields found in ctx to each record and forwards
+// errors to Sentry.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		record.AddAttrs(contextAttrs(ctx)...)
+	}
+
+	if record.Level >= slog.LevelError {
+		addBreadcrumb(ctx, record)
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func addBreadcrumb(ctx context.Context, record slog.Record) {
+	hub := sentry.CurrentHub()
+	if ctx != nil {
+		if fromContext := sentry.GetHubFromContext(ctx); fromContext != nil {
+			hub = fromContext
+		}
+	}
+
+	data := map[string]interface{}{}
+	record.Attrs(func(attr slog.Attr) bool {
+		data[attr.Key] = attr.Value.String()
+		return true
+	})
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:      "error",
+		Category:  "log",
+		Message:   strings.TrimSpace(record.Message),
+		Data:      data,
+		Level:     sentry.LevelError,
+		Timestamp: record.Time,
+	}, nil)
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Options configures the OpenTelemetry side of tracing. Sentry is set up
+// separately by the telemetry package.
+type Options struct {
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+	// OTLPEndpoint is the host:port or URL of an OTLP/HTTP collector. Without
+	// one, OpenTelemetry stays a no-op and only Sentry records spans.
+	OTLPEndpoint string
+	// Insecure sends to the collector over plain HTTP.
+	Insecure bool
+}
+
+// OptionsFromEnv reads OTEL_EXPORTER_OTLP_ENDPOINT (or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) and OTEL_EXPORTER_OTLP_INSECURE.
+func OptionsFromEnv(service, version, environment string) (Options, error) {
+	options := Options{
+		ServiceName:    service,
+		ServiceVersion: version,
+		Environment:    environment,
+		OTLPEndpoint:   os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+	}
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); options.OTLPEndpoint == "" && base != "" {
+		// The generic endpoint is a base URL the signal path goes under.
+		options.OTLPEndpoint = base
+		if isURL(base) {
+			options.OTLPEndpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_INSECURE"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("❌ Invalid OTEL_EXPORTER_OTLP_INSECURE: %w", err)
+		}
+		options.Insecure = insecure
+	}
+
+	return options, nil
+}
+
+// Init sets up the OpenTelemetry tracer provider with an OTLP/HTTP exporter.
+// The returned function flushes and stops it, and should run on shutdown.
+func Init(ctx context.Context, options Options) (func(context.Context) error, error) {
+	if options.OTLPEndpoint == "" {
+		log.Println("🚫 OpenTelemetry: No OTLP endpoint set, spans are only sent to Sentry")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOptions := []otlptracehttp.Option{endpointOption(options.OTLPEndpoint)}
+	if options.Insecure {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", options.ServiceName),
+		attribute.String("service.version", options.ServiceVersion),
+		attribute.String("deployment.environment", options.Environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("❌ Failed to create OpenTelemetry resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	log.Printf("✅ OpenTelemetry: Exporting spans to %s", options.OTLPEndpoint)
+	return provider.Shutdown, nil
+}
+
+// endpointOption accepts both a bare host:port and a full URL to the traces
+// endpoint, as the OTLP env vars do.
+func endpointOption(endpoint string) otlptracehttp.Option {
+	if isURL(endpoint) {
+		return otlptracehttp.WithEndpointURL(endpoint)
+	}
+	return otlptracehttp.WithEndpoint(endpoint)
+}
+
+func isURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://")
+}
@@ -0,0 +1,397 @@
+package stations
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStations = "oven=2,grill=2,cold_prep=3"
+	// DefaultCookTimes is the cook time range of each default station.
+	DefaultCookTimes       = "oven=15s-25s,grill=10s-20s,cold_prep=5s-10s"
+	defaultProductStations = "1=oven,2=cold_prep,3=oven,4=cold_prep,5=cold_prep"
+	defaultStation         = "cold_prep"
+)
+
+// Station is a part of the kitchen that can only work on a limited number of
+// orders at once. Orders that don't fit wait for a slot in FIFO order.
+type Station struct {
+	Name        string
+	Concurrency int
+
+	mu          sync.Mutex
+	minCookTime time.Duration
+	maxCookTime time.Duration
+	busy        int
+	waiting     []chan struct{}
+}
+
+func NewStation(name string, concurrency int, minCookTime, maxCookTime time.Duration) *Station {
+	return &Station{
+		Name:        name,
+		Concurrency: concurrency,
+		minCookTime: minCookTime,
+		maxCookTime: maxCookTime,
+	}
+}
+
+// Acquire blocks until the station has a free slot for the caller or the
+// context is done. Every successful Acquire must be paired with a Release.
+func (s *Station) Acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.busy < s.Concurrency && len(s.waiting) == 0 {
+		s.busy++
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	s.waiting = append(s.waiting, ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for i, waiter := range s.waiting {
+			if waiter == ready {
+				s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+				s.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+		s.mu.Unlock()
+
+		// The slot was handed over while we were giving up, pass it on
+		s.Release()
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot, handing it straight to the longest waiting order if
+// there is one.
+func (s *Station) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.waiting) > 0 {
+		next := s.waiting[0]
+		s.waiting = s.waiting[1:]
+		close(next)
+		return
+	}
+
+	s.busy--
+}
+
+// QueueDepth returns how many orders are waiting for a slot.
+func (s *Station) QueueDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiting)
+}
+
+// Busy returns how many slots are taken.
+func (s *Station) Busy() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.busy
+}
+
+// CookTime picks how long the station takes to cook a batch.
+func (s *Station) CookTime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxCookTime <= s.minCookTime {
+		return s.minCookTime
+	}
+	return s.minCookTime + time.Duration(rand.Int63n(int64(s.maxCookTime-s.minCookTime)))
+}
+
+// AverageCookTime is the midpoint of the station's cook time range.
+func (s *Station) AverageCookTime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.minCookTime + (s.maxCookTime-s.minCookTime)/2
+}
+
+// SetCookTime changes the station's cook time range. Batches already cooking
+// keep the time they were given.
+func (s *Station) SetCookTime(minCookTime, maxCookTime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minCookTime = minCookTime
+	s.maxCookTime = maxCookTime
+}
+
+// Line is the kitchen line: its stations and the station each product is
+// cooked at.
+type Line struct {
+	stations        map[string]*Station
+	productStations map[int]string
+	defaultStation  string
+}
+
+// NewLineFromEnv builds the kitchen line from KITCHEN_STATIONS,
+// KITCHEN_COOK_TIMES, KITCHEN_PRODUCT_STATIONS and KITCHEN_DEFAULT_STATION,
+// falling back to a small oven/grill/cold prep setup.
+func NewLineFromEnv() (*Line, error) {
+	concurrency, err := parsePairs(getEnv("KITCHEN_STATIONS", defaultStations))
+	if err != nil {
+		return nil, fmt.Errorf("❌ Invalid KITCHEN_STATIONS: %w", err)
+	}
+
+	cookTimes, err := parsePairs(getEnv("KITCHEN_COOK_TIMES", DefaultCookTimes))
+	if err != nil {
+		return nil, fmt.Errorf("❌ Invalid KITCHEN_COOK_TIMES: %w", err)
+	}
+
+	productStations, err := parsePairs(getEnv("KITCHEN_PRODUCT_STATIONS", defaultProductStations))
+	if err != nil {
+		return nil, fmt.Errorf("❌ Invalid KITCHEN_PRODUCT_STATIONS: %w", err)
+	}
+
+	line := &Line{
+		stations:        make(map[string]*Station, len(concurrency)),
+		productStations: make(map[int]string, len(productStations)),
+		defaultStation:  getEnv("KITCHEN_DEFAULT_STATION", defaultStation),
+	}
+
+	for name, value := range concurrency {
+		slots, err := strconv.Atoi(value)
+		if err != nil || slots < 1 {
+			return nil, fmt.Errorf("❌ Invalid concurrency %q for station %s", value, name)
+		}
+
+		minCookTime, maxCookTime, err := parseDurationRange(cookTimes[name])
+		if err != nil {
+			return nil, fmt.Errorf("❌ Invalid cook time for station %s: %w", name, err)
+		}
+
+		line.stations[name] = NewStation(name, slots, minCookTime, maxCookTime)
+	}
+
+	if _, ok := line.stations[line.defaultStation]; !ok {
+		return nil, fmt.Errorf("❌ Default station %s is not configured", line.defaultStation)
+	}
+
+	for product, station := range productStations {
+		productID, err := strconv.Atoi(product)
+		if err != nil {
+			return nil, fmt.Errorf("❌ Invalid product id %q: %w", product, err)
+		}
+		if _, ok := line.stations[station]; !ok {
+			return nil, fmt.Errorf("❌ Product %d is mapped to unknown station %s", productID, station)
+		}
+		line.productStations[productID] = station
+	}
+
+	return line, nil
+}
+
+// CookTimeRange is how long a station takes to cook a batch.
+type CookTimeRange struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// ParseCookTimes parses cook times in the KITCHEN_COOK_TIMES format, e.g.
+// "oven=15s-25s,grill=10s-20s".
+func ParseCookTimes(value string) (map[string]CookTimeRange, error) {
+	pairs, err := parsePairs(value)
+	if err != nil {
+		return nil, err
+	}
+
+	cookTimes := make(map[string]CookTimeRange, len(pairs))
+	for name, spec := range pairs {
+		minCookTime, maxCookTime, err := parseDurationRange(spec)
+		if err != nil {
+			return nil, fmt.Errorf("station %s: %w", name, err)
+		}
+		cookTimes[name] = CookTimeRange{Min: minCookTime, Max: maxCookTime}
+	}
+
+	return cookTimes, nil
+}
+
+// CheckCookTimes parses value like ParseCookTimes and checks that it only
+// names stations configured in KITCHEN_STATIONS, which SetCookTimes requires
+// of a line built by NewLineFromEnv.
+func CheckCookTimes(value string) error {
+	cookTimes, err := ParseCookTimes(value)
+	if err != nil {
+		return err
+	}
+
+	concurrency, err := parsePairs(getEnv("KITCHEN_STATIONS", defaultStations))
+	if err != nil {
+		return fmt.Errorf("invalid KITCHEN_STATIONS: %w", err)
+	}
+	for name := range cookTimes {
+		if _, ok := concurrency[name]; !ok {
+			return fmt.Errorf("unknown station %s", name)
+		}
+	}
+	return nil
+}
+
+// SetCookTimes changes the cook times of the stations in value, which uses
+// the KITCHEN_COOK_TIMES format. Stations it doesn't mention are left as
+// they are.
+func (l *Line) SetCookTimes(value string) error {
+	cookTimes, err := ParseCookTimes(value)
+	if err != nil {
+		return err
+	}
+
+	for name := range cookTimes {
+		if _, ok := l.stations[name]; !ok {
+			return fmt.Errorf("unknown station %s", name)
+		}
+	}
+
+	for name, cookTime := range cookTimes {
+		l.stations[name].SetCookTime(cookTime.Min, cookTime.Max)
+	}
+
+	return nil
+}
+
+// StationFor returns the station a product is cooked at.
+func (l *Line) StationFor(productID int) *Station {
+	name, ok := l.productStations[productID]
+	if !ok {
+		name = l.defaultStation
+	}
+	return l.stations[name]
+}
+
+// EstimateReadyIn estimates how long it takes to cook an order with the given
+// products, based on how long each product historically took and on how many
+// orders are ahead of it at each station. Products without history are
+// assumed to take their station's average cook time.
+func (l *Line) EstimateReadyIn(productIDs []int, history map[int]time.Duration) time.Duration {
+	cookTimes := make(map[*Station]time.Duration)
+	for _, productID := range productIDs {
+		station := l.StationFor(productID)
+		cookTime, ok := history[productID]
+		if !ok {
+			cookTime = station.AverageCookTime()
+		}
+		if cookTime > cookTimes[station] {
+			cookTimes[station] = cookTime
+		}
+	}
+
+	var readyIn time.Duration
+	for station, cookTime := range cookTimes {
+		// Orders ahead of this one, including the ones already cooking, leave
+		// the station in rounds of its concurrency
+		rounds := (station.QueueDepth() + station.Busy()) / station.Concurrency
+		stationReadyIn := time.Duration(rounds)*station.AverageCookTime() + cookTime
+		if stationReadyIn > readyIn {
+			readyIn = stationReadyIn
+		}
+	}
+
+	return readyIn
+}
+
+// Stations returns every station on the line, sorted by name.
+func (l *Line) Stations() []*Station {
+	stations := make([]*Station, 0, len(l.stations))
+	for _, station := range l.stations {
+		stations = append(stations, station)
+	}
+	sort.Slice(stations, func(i, j int) bool {
+		return stations[i].Name < stations[j].Name
+	})
+	return stations
+}
+
+// StationState describes a station for the admin endpoints.
+type StationState struct {
+	Name        string `json:"name"`
+	Concurrency int    `json:"concurrency"`
+	Busy        int    `json:"busy"`
+	QueueDepth  int    `json:"queue_depth"`
+	CookTime    string `json:"cook_time"`
+}
+
+// State returns the state of every station on the line, sorted by name.
+func (l *Line) State() []StationState {
+	var states []StationState
+	for _, station := range l.Stations() {
+		station.mu.Lock()
+		states = append(states, StationState{
+			Name:        station.Name,
+			Concurrency: station.Concurrency,
+			Busy:        station.busy,
+			QueueDepth:  len(station.waiting),
+			CookTime:    fmt.Sprintf("%s-%s", station.minCookTime, station.maxCookTime),
+		})
+		station.mu.Unlock()
+	}
+	return states
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// parsePairs parses "key=value,key=value" lists.
+func parsePairs(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return pairs, nil
+}
+
+// parseDurationRange parses "10s-20s" ranges. A single duration is a range
+// of one.
+func parseDurationRange(value string) (time.Duration, time.Duration, error) {
+	if value == "" {
+		return 0, 0, fmt.Errorf("missing cook time")
+	}
+
+	lower, upper, found := strings.Cut(value, "-")
+	minDuration, err := time.ParseDuration(lower)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return minDuration, minDuration, nil
+	}
+
+	maxDuration, err := time.ParseDuration(upper)
+	if err != nil {
+		return 0, 0, err
+	}
+	if maxDuration < minDuration {
+		return 0, 0, fmt.Errorf("%s is shorter than %s", upper, lower)
+	}
+
+	return minDuration, maxDuration, nil
+}
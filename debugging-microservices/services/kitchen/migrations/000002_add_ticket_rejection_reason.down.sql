@@ -0,0 +1 @@
+ALTER TABLE tickets DROP COLUMN IF EXISTS rejection_reason;
\ No newline at end of file
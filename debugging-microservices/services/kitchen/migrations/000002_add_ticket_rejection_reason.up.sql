@@ -0,0 +1 @@
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS rejection_reason TEXT NOT NULL DEFAULT '';
\ No newline at end of file
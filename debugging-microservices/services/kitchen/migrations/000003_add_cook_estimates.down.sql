@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_ticket_items_product_id;
+
+ALTER TABLE ticket_items DROP COLUMN IF EXISTS cook_duration_ms;
+
+ALTER TABLE tickets DROP COLUMN IF EXISTS estimated_ready_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS estimated_ready_at TIMESTAMP;
+
+ALTER TABLE ticket_items ADD COLUMN IF NOT EXISTS cook_duration_ms INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_ticket_items_product_id ON ticket_items(product_id);
\ No newline at end of file
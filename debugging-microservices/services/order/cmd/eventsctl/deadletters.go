@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order/internal/messaging"
+	"order/internal/platform/amqptrace"
+	"order/internal/platform/tracing"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Channel is the part of *amqp.Channel DeadLetters needs, wrapped by
+// AMQPChannel. Replaying needs the channel to be in confirm mode.
+type Channel interface {
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (Confirmation, error)
+	QueuePurge(name string, noWait bool) (int, error)
+}
+
+// Confirmation is the broker's answer to a publish, as with
+// *amqp.DeferredConfirmation.
+type Confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// AMQPChannel is a Channel backed by a broker.
+type AMQPChannel struct {
+	*amqp.Channel
+}
+
+func (c AMQPChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (Confirmation, error) {
+	confirmation, err := c.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	// Outside confirm mode there is no confirmation, which mustn't turn into
+	// a non-nil Confirmation.
+	if err != nil || confirmation == nil {
+		return nil, err
+	}
+	return confirmation, nil
+}
+
+// DeadLetters reads, replays and purges the dead-letter queues of the
+// service queues bound to order_events.
+type DeadLetters struct {
+	channel Channel
+}
+
+func NewDeadLetters(channel Channel) *DeadLetters {
+	return &DeadLetters{channel: channel}
+}
+
+// DeadLetter is a dead-lettered message, as listed.
+type DeadLetter struct {
+	Queue     string `json:"queue"`
+	MessageID string `json:"message_id"`
+	// RoutingKey is the key the message was originally published with, which
+	// tells the consumer what event it is.
+	RoutingKey     string          `json:"routing_key"`
+	TraceID        string          `json:"trace_id,omitempty"`
+	Reason         string          `json:"reason,omitempty"`
+	Deaths         int64           `json:"deaths"`
+	PublishedAt    *time.Time      `json:"published_at,omitempty"`
+	DeadLetteredAt *time.Time      `json:"dead_lettered_at,omitempty"`
+	OrderID        *int32          `json:"order_id,omitempty"`
+	Event          json.RawMessage `json:"event,omitempty"`
+	DecodeError    string          `json:"decode_error,omitempty"`
+}
+
+// Selector picks the dead-lettered messages to replay or purge. A message
+// must match every criterion that's set.
+type Selector struct {
+	All        bool
+	MessageIDs []string
+	RoutingKey string
+	OrderID    *int32
+}
+
+func (s Selector) empty() bool {
+	return !s.All && len(s.MessageIDs) == 0 && s.RoutingKey == "" && s.OrderID == nil
+}
+
+func (s Selector) matches(letter *DeadLetter) bool {
+	if s.All {
+		return true
+	}
+	if s.empty() {
+		return false
+	}
+	if len(s.MessageIDs) > 0 && !contains(s.MessageIDs, letter.MessageID) {
+		return false
+	}
+	if s.RoutingKey != "" && s.RoutingKey != letter.RoutingKey {
+		return false
+	}
+	if s.OrderID != nil && (letter.OrderID == nil || *letter.OrderID != *s.OrderID) {
+		return false
+	}
+	return true
+}
+
+// List returns up to limit messages from the dead-letter queue of queue,
+// oldest first, leaving them in it. A limit of 0 lists them all.
+func (d *DeadLetters) List(queue string, limit int) ([]DeadLetter, error) {
+	msgs, err := d.fetch(queue, limit)
+	defer requeue(msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, len(msgs))
+	for i := range msgs {
+		letters[i] = describe(queue, &msgs[i])
+	}
+	return letters, nil
+}
+
+// Replay publishes the selected messages from the dead-letter queue of queue
+// to order_events again with their original routing key, and removes them
+// from the dead-letter queue once the broker confirms them. Every queue bound
+// to the key gets them, as when they were first published. Their headers go
+// along, so processing them continues the trace they started in, but not the
+// redelivery count, so they get their retries afresh. It returns the
+// messages replayed.
+func (d *DeadLetters) Replay(ctx context.Context, queue string, selector Selector) ([]DeadLetter, error) {
+	if selector.empty() {
+		return nil, errors.New("no messages selected")
+	}
+
+	msgs, err := d.fetch(queue, 0)
+	if err != nil {
+		requeue(msgs)
+		return nil, err
+	}
+
+	var replayed []DeadLetter
+	for i := range msgs {
+		msg := &msgs[i]
+		letter := describe(queue, msg)
+		if !selector.matches(&letter) {
+			msg.Nack(false, true)
+			continue
+		}
+
+		if err := d.republish(ctx, msg, letter.RoutingKey); err != nil {
+			requeue(msgs[i:])
+			return replayed, fmt.Errorf("❌ Failed to replay message %q: %w", letter.MessageID, err)
+		}
+		if err := msg.Ack(false); err != nil {
+			requeue(msgs[i+1:])
+			return replayed, fmt.Errorf("❌ Replayed message %q but failed to remove it: %w", letter.MessageID, err)
+		}
+		replayed = append(replayed, letter)
+	}
+
+	return replayed, nil
+}
+
+// Purge removes the selected messages from the dead-letter queue of queue
+// and returns how many it removed.
+func (d *DeadLetters) Purge(queue string, selector Selector) (int, error) {
+	if selector.empty() {
+		return 0, errors.New("no messages selected")
+	}
+	if selector.All {
+		return d.channel.QueuePurge(messaging.DeadLetterQueue(queue), false)
+	}
+
+	msgs, err := d.fetch(queue, 0)
+	if err != nil {
+		requeue(msgs)
+		return 0, err
+	}
+
+	purged := 0
+	for i := range msgs {
+		msg := &msgs[i]
+		letter := describe(queue, msg)
+		if !selector.matches(&letter) {
+			msg.Nack(false, true)
+			continue
+		}
+
+		if err := msg.Ack(false); err != nil {
+			requeue(msgs[i+1:])
+			return purged, fmt.Errorf("❌ Failed to purge message %q: %w", letter.MessageID, err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// fetch takes up to limit messages from the dead-letter queue of queue
+// without acking them, so each is seen once. Every message it returns has to
+// be acked or requeued, even along with an error.
+func (d *DeadLetters) fetch(queue string, limit int) ([]amqp.Delivery, error) {
+	var msgs []amqp.Delivery
+	for limit == 0 || len(msgs) < limit {
+		msg, ok, err := d.channel.Get(messaging.DeadLetterQueue(queue), false)
+		if err != nil {
+			return msgs, fmt.Errorf("❌ AMQP: Failed to read %s: %w", messaging.DeadLetterQueue(queue), err)
+		}
+		if !ok {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (d *DeadLetters) republish(ctx context.Context, msg *amqp.Delivery, routingKey string) error {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	delete(headers, amqptrace.RedeliveryHeader)
+	delete(headers, amqptrace.RetryQueueHeader)
+
+	confirmation, err := d.channel.PublishWithDeferredConfirmWithContext(ctx, "order_events", routingKey, false, false, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+	if confirmation == nil {
+		return errors.New("channel is not in confirm mode")
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("broker nacked the message")
+	}
+	return nil
+}
+
+func requeue(msgs []amqp.Delivery) {
+	for i := range msgs {
+		msgs[i].Nack(false, true)
+	}
+}
+
+// describe reads what's known about a dead-lettered message from its
+// headers and body.
+func describe(queue string, msg *amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		Queue:      queue,
+		MessageID:  msg.MessageId,
+		RoutingKey: msg.RoutingKey,
+		TraceID:    traceID(msg.Headers),
+	}
+	if !msg.Timestamp.IsZero() {
+		letter.PublishedAt = &msg.Timestamp
+	}
+
+	// The broker prepends an x-death entry for every queue the message was
+	// dead-lettered from; the one for queue has how it got here.
+	if deaths, ok := msg.Headers["x-death"].([]interface{}); ok {
+		for _, death := range deaths {
+			table, ok := death.(amqp.Table)
+			if !ok || table["queue"] != queue {
+				continue
+			}
+			if keys, ok := table["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+				if key, ok := keys[0].(string); ok {
+					letter.RoutingKey = key
+				}
+			}
+			letter.Reason, _ = table["reason"].(string)
+			letter.Deaths, _ = table["count"].(int64)
+			if at, ok := table["time"].(time.Time); ok {
+				letter.DeadLetteredAt = &at
+			}
+			break
+		}
+	}
+	event, err := decodeEvent(letter.RoutingKey, msg.Body)
+	if err != nil {
+		letter.DecodeError = err.Error()
+		return letter
+	}
+	if id, ok := orderID(event); ok {
+		letter.OrderID = &id
+	}
+	letter.Event, err = eventJSON(event)
+	if err != nil {
+		letter.DecodeError = err.Error()
+	}
+	return letter
+}
+
+// traceID returns the trace a message was published in, from its
+// traceparent or sentry-trace header.
+func traceID(headers amqp.Table) string {
+	carrier := tracing.TableCarrier(headers)
+	// 00-<trace id>-<span id>-<flags>
+	if parts := strings.Split(carrier.Get("traceparent"), "-"); len(parts) == 4 {
+		return parts[1]
+	}
+	// <trace id>-<span id>[-<sampled>]
+	if traceID, _, ok := strings.Cut(carrier.Get("sentry-trace"), "-"); ok {
+		return traceID
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
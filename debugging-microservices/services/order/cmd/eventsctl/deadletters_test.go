@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"order/internal/events"
+	"order/internal/messaging"
+	"order/internal/platform/amqpfake"
+	"order/internal/platform/amqptrace"
+	"reflect"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+const testQueue = "kitchen_service_events"
+
+// fakeChannel is a Channel on an amqpfake broker, adapted as AMQPChannel
+// adapts a real one.
+type fakeChannel struct {
+	*amqpfake.Channel
+}
+
+func (c fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (Confirmation, error) {
+	confirmation, err := c.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err != nil || confirmation == nil {
+		return nil, err
+	}
+	return confirmation, nil
+}
+
+// newBroker declares order_events and testQueue with its dead-letter and
+// retry queues, as the kitchen service does, bound to the keys of the test
+// messages. The order service's queue also gets kitchen.rejected. It
+// returns a channel in confirm mode, as eventsctl uses.
+func newBroker(t *testing.T) (*amqpfake.Broker, *amqpfake.Channel) {
+	t.Helper()
+
+	broker := amqpfake.NewBroker()
+	ch := broker.Channel()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("declaring the topology: %v", err)
+		}
+	}
+	must(ch.ExchangeDeclare("order_events", amqp.ExchangeTopic, true, false, false, false, nil))
+	must(ch.ExchangeDeclare(messaging.DeadLetterExchange, amqp.ExchangeDirect, true, false, false, false, nil))
+	must(ch.ExchangeDeclare(messaging.RetryExchange, amqp.ExchangeHeaders, true, false, false, false, nil))
+	must(ch.ExchangeDeclare(messaging.RetriedExchange, amqp.ExchangeHeaders, true, false, false, false, nil))
+
+	queues := map[string][]string{
+		testQueue:              {"order.ready_for_kitchen", "kitchen.rejected"},
+		"order_service_events": {"kitchen.rejected"},
+	}
+	for queue, keys := range queues {
+		dlq := messaging.DeadLetterQueue(queue)
+		_, err := ch.QueueDeclare(dlq, true, false, false, false, nil)
+		must(err)
+		must(ch.QueueBind(dlq, dlq, messaging.DeadLetterExchange, false, nil))
+
+		_, err = ch.QueueDeclare(queue, true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    messaging.DeadLetterExchange,
+			"x-dead-letter-routing-key": dlq,
+		})
+		must(err)
+		for _, key := range keys {
+			must(ch.QueueBind(queue, key, "order_events", false, nil))
+		}
+
+		retryQueue := messaging.RetryQueue(queue)
+		_, err = ch.QueueDeclare(retryQueue, true, false, false, false, amqp.Table{
+			"x-message-ttl":          int64(5000),
+			"x-dead-letter-exchange": messaging.RetriedExchange,
+		})
+		must(err)
+		binding := amqp.Table{"x-match": "all", amqptrace.RetryQueueHeader: queue}
+		must(ch.QueueBind(retryQueue, "", messaging.RetryExchange, false, binding))
+		must(ch.QueueBind(queue, "", messaging.RetriedExchange, false, binding))
+	}
+	must(ch.Confirm(false))
+
+	return broker, ch
+}
+
+// testMessage is published to order_events and dead-lettered from testQueue.
+type testMessage struct {
+	id, routingKey string
+	// event is the body, or nil for one that doesn't decode.
+	event   proto.Message
+	headers amqp.Table
+	// retries is how many times the consumer sent it back to be tried again
+	// before rejecting it.
+	retries int
+}
+
+// testMessages end up in the dead-letter queue of testQueue in this order.
+func testMessages() []testMessage {
+	return []testMessage{
+		{
+			id: "order.ready_for_kitchen.42", routingKey: "order.ready_for_kitchen",
+			event:   &events.ReadyForKitchenEvent{OrderId: 42},
+			headers: amqp.Table{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			retries: amqptrace.MaxRedeliveries,
+		},
+		{
+			id: "order.ready_for_kitchen.7", routingKey: "order.ready_for_kitchen",
+			event:   &events.ReadyForKitchenEvent{OrderId: 7},
+			headers: amqp.Table{"sentry-trace": "0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-1"},
+		},
+		{
+			id: "kitchen.rejected.42", routingKey: "kitchen.rejected",
+			event: &events.KitchenRejectedOrderEvent{OrderId: 42, Reason: "closed"},
+		},
+		{id: "garbled", routingKey: "order.ready_for_kitchen"},
+	}
+}
+
+// deadLetter publishes msgs and has the consumer of testQueue reject them,
+// sending them back to be tried again first as often as they say, as
+// amqptrace does. The order service's queue is left empty.
+func deadLetter(t *testing.T, broker *amqpfake.Broker, ch *amqpfake.Channel, msgs []testMessage) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, msg := range msgs {
+		body := []byte("not protobuf")
+		if msg.event != nil {
+			body, _ = proto.Marshal(msg.event)
+		}
+		headers := amqp.Table{}
+		for key, value := range msg.headers {
+			headers[key] = value
+		}
+		err := ch.PublishWithContext(ctx, "order_events", msg.routingKey, false, false, amqp.Publishing{
+			MessageId:    msg.id,
+			ContentType:  "application/x-protobuf",
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Body:         body,
+		})
+		if err != nil {
+			t.Fatalf("publishing %s: %v", msg.id, err)
+		}
+
+		for attempt := 0; ; attempt++ {
+			delivery, ok, err := ch.Get(testQueue, false)
+			if err != nil || !ok {
+				t.Fatalf("consuming %s: %t, %v", msg.id, ok, err)
+			}
+			if attempt == msg.retries {
+				if err := delivery.Reject(false); err != nil {
+					t.Fatalf("rejecting %s: %v", msg.id, err)
+				}
+				break
+			}
+
+			headers := amqp.Table{}
+			for key, value := range delivery.Headers {
+				headers[key] = value
+			}
+			headers[amqptrace.RedeliveryHeader] = int64(attempt + 1)
+			headers[amqptrace.RetryQueueHeader] = testQueue
+			err = ch.PublishWithContext(ctx, messaging.RetryExchange, delivery.RoutingKey, false, false, amqp.Publishing{
+				MessageId:    delivery.MessageId,
+				ContentType:  delivery.ContentType,
+				DeliveryMode: delivery.DeliveryMode,
+				Headers:      headers,
+				Body:         delivery.Body,
+			})
+			if err != nil {
+				t.Fatalf("retrying %s: %v", msg.id, err)
+			}
+			if err := delivery.Ack(false); err != nil {
+				t.Fatalf("acking %s: %v", msg.id, err)
+			}
+			broker.Advance(time.Minute)
+		}
+	}
+
+	if _, err := ch.QueuePurge("order_service_events", false); err != nil {
+		t.Fatalf("QueuePurge: %v", err)
+	}
+}
+
+// ids returns the message ids of msgs, in order.
+func ids(msgs []amqp.Delivery) []string {
+	var ids []string
+	for _, msg := range msgs {
+		ids = append(ids, msg.MessageId)
+	}
+	return ids
+}
+
+func TestList(t *testing.T) {
+	orderID := func(id int32) *int32 { return &id }
+
+	tests := []struct {
+		name  string
+		msgs  []testMessage
+		limit int
+		want  []DeadLetter
+	}{
+		{
+			name:  "all",
+			msgs:  testMessages(),
+			limit: 0,
+			want: []DeadLetter{
+				{MessageID: "order.ready_for_kitchen.42", RoutingKey: "order.ready_for_kitchen", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", OrderID: orderID(42)},
+				{MessageID: "order.ready_for_kitchen.7", RoutingKey: "order.ready_for_kitchen", TraceID: "0af7651916cd43dd8448eb211c80319c", OrderID: orderID(7)},
+				{MessageID: "kitchen.rejected.42", RoutingKey: "kitchen.rejected", OrderID: orderID(42)},
+				{MessageID: "garbled", RoutingKey: "order.ready_for_kitchen"},
+			},
+		},
+		{
+			name:  "limit",
+			msgs:  testMessages(),
+			limit: 1,
+			want: []DeadLetter{
+				{MessageID: "order.ready_for_kitchen.42", RoutingKey: "order.ready_for_kitchen", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", OrderID: orderID(42)},
+			},
+		},
+		{
+			// Each retry expires from the retry queue, which the broker
+			// records in x-death ahead of the rejection.
+			name: "retried before it was rejected",
+			msgs: []testMessage{
+				{id: "kitchen.rejected.42", routingKey: "kitchen.rejected", event: &events.KitchenRejectedOrderEvent{OrderId: 42}, retries: 2},
+			},
+			want: []DeadLetter{
+				{MessageID: "kitchen.rejected.42", RoutingKey: "kitchen.rejected", OrderID: orderID(42)},
+			},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, ch := newBroker(t)
+			deadLetter(t, broker, ch, tt.msgs)
+			deadLetteredAt := broker.Now()
+			before := ids(broker.Messages(messaging.DeadLetterQueue(testQueue)))
+
+			letters, err := NewDeadLetters(fakeChannel{ch}).List(testQueue, tt.limit)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+
+			if len(letters) != len(tt.want) {
+				t.Fatalf("listed %d messages, want %d: %+v", len(letters), len(tt.want), letters)
+			}
+			for i, letter := range letters {
+				want := tt.want[i]
+				if letter.Queue != testQueue || letter.MessageID != want.MessageID || letter.RoutingKey != want.RoutingKey || letter.TraceID != want.TraceID {
+					t.Errorf("message %d = %s %s %s %s, want %s %s %s %s", i,
+						letter.Queue, letter.MessageID, letter.RoutingKey, letter.TraceID,
+						testQueue, want.MessageID, want.RoutingKey, want.TraceID)
+				}
+				if letter.Reason != "rejected" || letter.Deaths != 1 || letter.DeadLetteredAt == nil || !letter.DeadLetteredAt.Equal(deadLetteredAt) {
+					t.Errorf("message %d died %d time(s) for %q at %v, want once for rejected at %v", i, letter.Deaths, letter.Reason, letter.DeadLetteredAt, deadLetteredAt)
+				}
+				if !reflect.DeepEqual(letter.OrderID, want.OrderID) {
+					t.Errorf("message %d order = %v, want %v", i, letter.OrderID, want.OrderID)
+				}
+				if (want.OrderID == nil) != (letter.DecodeError != "") {
+					t.Errorf("message %d decode error = %q", i, letter.DecodeError)
+				}
+				if letter.DecodeError == "" && len(letter.Event) == 0 {
+					t.Errorf("message %d has no event", i)
+				}
+			}
+
+			if after := ids(broker.Messages(messaging.DeadLetterQueue(testQueue))); !reflect.DeepEqual(after, before) {
+				t.Errorf("queue after listing = %v, want %v", after, before)
+			}
+			if ch.Unacked() != 0 {
+				t.Errorf("%d messages left unacked", ch.Unacked())
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	orderID := int32(42)
+	all := []string{"order.ready_for_kitchen.42", "order.ready_for_kitchen.7", "kitchen.rejected.42", "garbled"}
+
+	tests := []struct {
+		name     string
+		selector Selector
+		// breakBroker runs after the messages are dead-lettered.
+		breakBroker func(t *testing.T, ch *amqpfake.Channel)
+		wantErr     bool
+		// replayed are the messages published, in order, and removed from the
+		// dead-letter queue.
+		replayed []string
+		remain   []string
+	}{
+		{
+			name:     "all",
+			selector: Selector{All: true},
+			replayed: all,
+		},
+		{
+			name:     "by order",
+			selector: Selector{OrderID: &orderID},
+			replayed: []string{"order.ready_for_kitchen.42", "kitchen.rejected.42"},
+			remain:   []string{"order.ready_for_kitchen.7", "garbled"},
+		},
+		{
+			name:     "by id",
+			selector: Selector{MessageIDs: []string{"order.ready_for_kitchen.7"}},
+			replayed: []string{"order.ready_for_kitchen.7"},
+			remain:   []string{"order.ready_for_kitchen.42", "kitchen.rejected.42", "garbled"},
+		},
+		{
+			// A full queue refusing the message makes the broker nack it.
+			name:     "nacked by the broker",
+			selector: Selector{RoutingKey: "kitchen.rejected"},
+			breakBroker: func(t *testing.T, ch *amqpfake.Channel) {
+				_, err := ch.QueueDeclare("full", true, false, false, false, amqp.Table{"x-max-length": int32(0), "x-overflow": "reject-publish"})
+				if err == nil {
+					err = ch.QueueBind("full", "kitchen.rejected", "order_events", false, nil)
+				}
+				if err != nil {
+					t.Fatalf("declaring a full queue: %v", err)
+				}
+			},
+			wantErr: true,
+			remain:  all,
+		},
+		{
+			// Publishing to a missing exchange closes the channel, which
+			// requeues everything taken from it.
+			name:     "publish failed",
+			selector: Selector{All: true},
+			breakBroker: func(t *testing.T, ch *amqpfake.Channel) {
+				if err := ch.ExchangeDelete("order_events", false, false); err != nil {
+					t.Fatalf("ExchangeDelete: %v", err)
+				}
+			},
+			wantErr: true,
+			remain:  all,
+		},
+		{
+			name:    "nothing selected",
+			wantErr: true,
+			remain:  all,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, ch := newBroker(t)
+			deadLetter(t, broker, ch, testMessages())
+			if tt.breakBroker != nil {
+				tt.breakBroker(t, ch)
+			}
+			original := map[string]amqp.Delivery{}
+			for _, msg := range broker.Messages(messaging.DeadLetterQueue(testQueue)) {
+				original[msg.MessageId] = msg
+			}
+
+			replayed, err := NewDeadLetters(fakeChannel{ch}).Replay(context.Background(), testQueue, tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Replay error = %v, want error %t", err, tt.wantErr)
+			}
+
+			var replayedIDs []string
+			var rejected []string
+			for _, letter := range replayed {
+				replayedIDs = append(replayedIDs, letter.MessageID)
+				if letter.RoutingKey == "kitchen.rejected" {
+					rejected = append(rejected, letter.MessageID)
+				}
+			}
+			if !reflect.DeepEqual(replayedIDs, tt.replayed) {
+				t.Errorf("replayed %v, want %v", replayedIDs, tt.replayed)
+			}
+			if remain := ids(broker.Messages(messaging.DeadLetterQueue(testQueue))); !reflect.DeepEqual(remain, tt.remain) {
+				t.Errorf("left %v in the dead-letter queue, want %v", remain, tt.remain)
+			}
+			if ch.Unacked() != 0 {
+				t.Errorf("%d messages left unacked", ch.Unacked())
+			}
+
+			// Every queue bound to the original routing key gets the replayed
+			// messages again. A nacked publish may have reached some of them.
+			republished := broker.Messages(testQueue)
+			if !tt.wantErr {
+				if got := ids(broker.Messages("order_service_events")); !reflect.DeepEqual(got, rejected) {
+					t.Errorf("order_service_events got %v, want %v", got, rejected)
+				}
+				if got := ids(republished); !reflect.DeepEqual(got, tt.replayed) {
+					t.Errorf("%s got %v, want %v", testQueue, got, tt.replayed)
+				}
+			}
+
+			for _, msg := range republished {
+				original := original[msg.MessageId]
+				if msg.Exchange != "order_events" || msg.RoutingKey != describe(testQueue, &original).RoutingKey {
+					t.Errorf("%s replayed through %q with key %q, want order_events with its original key",
+						msg.MessageId, msg.Exchange, msg.RoutingKey)
+				}
+				for _, header := range []string{"traceparent", "sentry-trace", "x-death"} {
+					if !reflect.DeepEqual(msg.Headers[header], original.Headers[header]) {
+						t.Errorf("%s replayed with %s %v, want %v", msg.MessageId, header, msg.Headers[header], original.Headers[header])
+					}
+				}
+				for _, header := range []string{amqptrace.RedeliveryHeader, amqptrace.RetryQueueHeader} {
+					if value, ok := msg.Headers[header]; ok {
+						t.Errorf("%s replayed with %s %v, want it dropped to retry afresh", msg.MessageId, header, value)
+					}
+				}
+				if string(msg.Body) != string(original.Body) || msg.DeliveryMode != original.DeliveryMode {
+					t.Errorf("%s replayed with a different body or delivery mode", msg.MessageId)
+				}
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	orderID := int32(7)
+
+	tests := []struct {
+		name     string
+		selector Selector
+		wantErr  bool
+		purged   int
+		remain   []string
+	}{
+		{
+			name:     "all",
+			selector: Selector{All: true},
+			purged:   4,
+		},
+		{
+			name:     "by routing key",
+			selector: Selector{RoutingKey: "order.ready_for_kitchen"},
+			purged:   3,
+			remain:   []string{"kitchen.rejected.42"},
+		},
+		{
+			name:     "by order and routing key",
+			selector: Selector{RoutingKey: "order.ready_for_kitchen", OrderID: &orderID},
+			purged:   1,
+			remain:   []string{"order.ready_for_kitchen.42", "kitchen.rejected.42", "garbled"},
+		},
+		{
+			name:     "no match",
+			selector: Selector{MessageIDs: []string{"order.created.1"}},
+			remain:   []string{"order.ready_for_kitchen.42", "order.ready_for_kitchen.7", "kitchen.rejected.42", "garbled"},
+		},
+		{
+			name:    "nothing selected",
+			wantErr: true,
+			remain:  []string{"order.ready_for_kitchen.42", "order.ready_for_kitchen.7", "kitchen.rejected.42", "garbled"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker, ch := newBroker(t)
+			deadLetter(t, broker, ch, testMessages())
+
+			purged, err := NewDeadLetters(fakeChannel{ch}).Purge(testQueue, tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Purge error = %v, want error %t", err, tt.wantErr)
+			}
+			if purged != tt.purged {
+				t.Errorf("purged %d, want %d", purged, tt.purged)
+			}
+			if remain := ids(broker.Messages(messaging.DeadLetterQueue(testQueue))); !reflect.DeepEqual(remain, tt.remain) {
+				t.Errorf("left %v in the dead-letter queue, want %v", remain, tt.remain)
+			}
+			if published := broker.Messages(testQueue); len(published) != 0 {
+				t.Errorf("purging published %v", ids(published))
+			}
+			if ch.Unacked() != 0 {
+				t.Errorf("%d messages left unacked", ch.Unacked())
+			}
+		})
+	}
+}
+
+func TestSelector(t *testing.T) {
+	order42, order7 := int32(42), int32(7)
+	letter := DeadLetter{MessageID: "order.ready_for_kitchen.42", RoutingKey: "order.ready_for_kitchen", OrderID: &order42}
+	undecoded := DeadLetter{MessageID: "garbled", RoutingKey: "order.ready_for_kitchen"}
+
+	tests := []struct {
+		name     string
+		selector Selector
+		letter   DeadLetter
+		empty    bool
+		matches  bool
+	}{
+		{"nothing", Selector{}, letter, true, false},
+		{"all", Selector{All: true}, undecoded, false, true},
+		{"id", Selector{MessageIDs: []string{"other", "order.ready_for_kitchen.42"}}, letter, false, true},
+		{"other id", Selector{MessageIDs: []string{"other"}}, letter, false, false},
+		{"routing key", Selector{RoutingKey: "order.ready_for_kitchen"}, letter, false, true},
+		{"other routing key", Selector{RoutingKey: "kitchen.rejected"}, letter, false, false},
+		{"order", Selector{OrderID: &order42}, letter, false, true},
+		{"other order", Selector{OrderID: &order7}, letter, false, false},
+		{"order of undecoded", Selector{OrderID: &order42}, undecoded, false, false},
+		{"every criterion", Selector{RoutingKey: "order.ready_for_kitchen", OrderID: &order42}, letter, false, true},
+		{"one criterion off", Selector{RoutingKey: "order.ready_for_kitchen", OrderID: &order7}, letter, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.empty(); got != tt.empty {
+				t.Errorf("empty() = %t, want %t", got, tt.empty)
+			}
+			if got := tt.selector.matches(&tt.letter); got != tt.matches {
+				t.Errorf("matches() = %t, want %t", got, tt.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"order/internal/events"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventTypes maps every routing key published to order_events to the event
+// its body holds.
+var eventTypes = map[string]func() proto.Message{
+	"order.created":            func() proto.Message { return &events.OrderCreatedEvent{} },
+	"inventory.reserved":       func() proto.Message { return &events.InventoryReservedEvent{} },
+	"order.ready_for_kitchen":  func() proto.Message { return &events.ReadyForKitchenEvent{} },
+	"kitchen.accepted":         func() proto.Message { return &events.KitchenAcceptedOrderEvent{} },
+	"kitchen.rejected":         func() proto.Message { return &events.KitchenRejectedOrderEvent{} },
+	"kitchen.order_cooked":     func() proto.Message { return &events.OrderCookedEvent{} },
+	"order.ready_for_delivery": func() proto.Message { return &events.OrderReadyForDeliveryEvent{} },
+	"delivery.started":         func() proto.Message { return &events.DeliveryStartedEvent{} },
+	"delivery.completed":       func() proto.Message { return &events.DeliveryCompletedEvent{} },
+	"delivery.failed":          func() proto.Message { return &events.DeliveryFailedEvent{} },
+	"order.rejected":           func() proto.Message { return &events.OrderRejectedEvent{} },
+}
+
+// decodeEvent unmarshals body as the event published with routingKey.
+func decodeEvent(routingKey string, body []byte) (proto.Message, error) {
+	newEvent, ok := eventTypes[routingKey]
+	if !ok {
+		return nil, fmt.Errorf("unknown routing key %q", routingKey)
+	}
+
+	event := newEvent()
+	if err := proto.Unmarshal(body, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// eventJSON formats event with the field names used in the .proto files.
+func eventJSON(event proto.Message) (json.RawMessage, error) {
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(event)
+}
+
+// orderID returns the order an event is about. Every event has one.
+func orderID(event proto.Message) (int32, bool) {
+	withOrder, ok := event.(interface{ GetOrderId() int32 })
+	if !ok {
+		return 0, false
+	}
+	return withOrder.GetOrderId(), true
+}
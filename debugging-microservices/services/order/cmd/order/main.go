@@ -2,34 +2,76 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
+	"order/internal/config"
 	"order/internal/handlers"
+	"order/internal/inventory"
 	"order/internal/messaging"
+	"order/internal/platform/admin"
+	"order/internal/platform/buildinfo"
 	"order/internal/platform/consul"
+	"order/internal/platform/dynconfig"
+	"order/internal/platform/faults"
+	"order/internal/platform/health"
+	"order/internal/platform/lifecycle"
+	"order/internal/platform/logging"
+	"order/internal/platform/metrics"
+	"order/internal/platform/telemetry"
+	"order/internal/platform/tracing"
 	"order/internal/repository"
 	"os"
+	"strconv"
 	"time"
 
-	"github.com/getsentry/sentry-go"
 	sentryhttp "github.com/getsentry/sentry-go/http"
 )
 
 func main() {
-	if err := sentry.Init(sentry.ClientOptions{
-		Dsn:              "https://fcb95d209acc4e623750364a39be9645@o4506044970565632.ingest.us.sentry.io/4509197456375808",
-		TracesSampleRate: 1.0,
-		AttachStacktrace: true,
-		EnableTracing:    true,
-		TracesSampler: sentry.TracesSampler(func(ctx sentry.SamplingContext) float64 {
-			if ctx.Span.Name == "GET /health" {
-				return 0.0
-			}
-			return 1.0
-		}),
-	}); err != nil {
-		log.Fatalf("Sentry initialization failed: %s", err)
+	if err := logging.Setup("order"); err != nil {
+		log.Fatal(err)
+	}
+	if err := faults.LoadFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	configSource, err := dynconfig.NewSourceFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), 5*time.Second)
+	settings, err := dynconfig.Load[config.Config](loadCtx, configSource, "order")
+	cancelLoad()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	telemetryOptions, err := telemetry.OptionsFromEnv("order")
+	if err != nil {
+		log.Fatal(err)
+	}
+	telemetryOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// The sample rate can be changed in Consul KV without a restart
+	telemetryOptions.SampleRate = func() float64 {
+		return settings.Current().TracesSampleRate
+	}
+	if err := telemetry.Init(telemetryOptions); err != nil {
+		log.Fatal(err)
+	}
+
+	tracingOptions, err := tracing.OptionsFromEnv("order", buildinfo.Read().Version, telemetryOptions.Environment)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), tracingOptions)
+	if err != nil {
+		log.Fatal(err)
 	}
+	tracing.OnFinish(metrics.ObserveSpan)
 
 	sentryHandler := sentryhttp.New(sentryhttp.Options{
 		Repanic: true,
@@ -44,36 +86,104 @@ func main() {
 	if err != nil {
 		log.Fatal("❌ Failed to create RabbitMQ client: ", err)
 	}
-	defer rabbitmq.Close()
 
-	handler := handlers.NewOrderHandler(orderRepo, rabbitmq)
+	discovery, err := consul.NewDiscovery(os.Getenv("CONSUL_HTTP_ADDR"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var inventoryClient *inventory.Client
+	if checkAvailability, _ := strconv.ParseBool(getEnv("ORDER_CHECK_AVAILABILITY", "true")); checkAvailability {
+		inventoryClient = inventory.NewClient(discovery.HTTPClient(2*time.Second), getEnv("INVENTORY_SERVICE_NAME", "inventory"))
+	}
+
+	handler := handlers.NewOrderHandler(orderRepo, rabbitmq, inventoryClient, settings)
 
-	http.HandleFunc("/health", sentryHandler.HandleFunc(handler.HandleHealthCheck))
-	http.HandleFunc("/orders", sentryHandler.HandleFunc(handler.HandleOrders))
+	metrics.ConnectionState(rabbitmq.Connected)
 
-	go rabbitmq.ConsumeEvents(
-		context.Background(),
-		handler.HandleInventoryReserved,
-		handler.HandleKitchenAccepted,
-		handler.HandleOrderCooked,
-		handler.HandleDeliveryStarted,
-		handler.HandleDeliveryCompleted,
-	)
+	checks := health.NewChecker()
+	checks.Add("postgres", orderRepo.Ping)
+	checks.Add("rabbitmq", rabbitmq.Ping)
+	checks.Add("consumer", rabbitmq.ConsumerHealth)
+
+	http.HandleFunc("GET /health/live", sentryHandler.HandleFunc(checks.HandleLive))
+	http.HandleFunc("GET /health/ready", sentryHandler.HandleFunc(checks.HandleReady))
+	// Kept for anything still probing the old endpoint.
+	http.HandleFunc("GET /health", sentryHandler.HandleFunc(checks.HandleReady))
+	http.Handle("GET /metrics", metrics.Handler())
+
+	adminRouter := admin.New(os.Getenv("ADMIN_TOKEN"))
+	adminRouter.Section("config", func(ctx context.Context) interface{} {
+		return settings.Values()
+	})
+	adminRouter.Consumer(rabbitmq)
+	faultsHandler := faults.Handler()
+	adminRouter.Handle("/admin/faults", faultsHandler)
+	adminRouter.Handle("/admin/faults/", faultsHandler)
+	http.Handle("/admin", adminRouter)
+	http.Handle("/admin/", adminRouter)
+
+	http.HandleFunc("/orders", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleOrders))))
+	http.HandleFunc("GET /orders/{orderId}", sentryHandler.HandleFunc(tracing.WrapHTTP(faults.WrapHTTP(handler.HandleGetOrder))))
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	consulConfig, err := consul.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{Addr: ":" + port}
+
+	lc := lifecycle.New(server)
+	// Registered first so it runs last, after everything that records spans.
+	lc.OnClose(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("❌ OpenTelemetry: Failed to flush spans: %v", err)
+		}
+	})
+	lc.OnClose(rabbitmq.Close)
+
+	lc.Go("Config watcher", settings.Watch)
+	lc.OnClose(discovery.Close)
+
+	lc.Go("AMQP consumer", func(ctx context.Context) error {
+		return rabbitmq.ConsumeEvents(
+			ctx,
+			handler.HandleInventoryReserved,
+			handler.HandleReservationFailed,
+			handler.HandleKitchenAccepted,
+			handler.HandleKitchenRejected,
+			handler.HandleOrderCooked,
+			handler.HandleDeliveryStarted,
+			handler.HandleDeliveryCompleted,
+			handler.HandleDeliveryFailed,
+		)
+	})
+
 	go func() {
 		time.Sleep(time.Second * 3)
-		if err := consul.RegisterService(); err != nil {
+		registration, err := consul.RegisterService(consulConfig)
+		if err != nil {
 			log.Fatal("❌ Failed to register with Consul: ", err)
 		}
+		registration.ReportHealth(checks.Ready)
+		lc.SetRegistration(registration.Deregister)
 	}()
 
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := lc.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
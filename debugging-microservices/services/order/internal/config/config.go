@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config holds the order service settings that can change at runtime. They
+// are read from Consul KV under config/order/, falling back to env and then
+// to the defaults below.
+type Config struct {
+	TaxRate             float64 `key:"tax_rate" env:"ORDER_TAX_RATE" default:"0.1"`
+	RejectPriceMismatch bool    `key:"reject_price_mismatch" env:"ORDER_REJECT_PRICE_MISMATCH" default:"false"`
+	// DefaultDeliveryTime is how long a delivery is assumed to take until the
+	// delivery service provides its own estimate.
+	DefaultDeliveryTime time.Duration `key:"default_delivery_time" env:"ORDER_DEFAULT_DELIVERY_TIME" default:"50s"`
+	TracesSampleRate    float64       `key:"traces_sample_rate" env:"SENTRY_TRACES_SAMPLE_RATE" default:"1.0"`
+}
+
+func (c *Config) Validate() error {
+	if c.TaxRate < 0 {
+		return fmt.Errorf("tax_rate must not be negative, got %v", c.TaxRate)
+	}
+	if c.DefaultDeliveryTime <= 0 {
+		return fmt.Errorf("default_delivery_time must be positive, got %s", c.DefaultDeliveryTime)
+	}
+	if c.TracesSampleRate < 0 || c.TracesSampleRate > 1 {
+		return fmt.Errorf("traces_sample_rate must be between 0 and 1, got %v", c.TracesSampleRate)
+	}
+	return nil
+}
@@ -2,14 +2,24 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"net/http"
+	"order/internal/config"
 	"order/internal/events"
+	"order/internal/inventory"
 	"order/internal/messaging"
 	"order/internal/models"
+	"order/internal/platform/dynconfig"
+	"order/internal/platform/faults"
+	"order/internal/platform/logging"
 	"order/internal/repository"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 )
@@ -17,40 +27,179 @@ import (
 type OrderHandler struct {
 	orderRepo *repository.OrderRepository
 	queue     *messaging.RabbitMQClient
+	// inventory checks stock before an order is accepted. It's nil when the
+	// check is turned off.
+	inventory *inventory.Client
+
+	// config holds the settings that can change at runtime, such as the tax
+	// rate.
+	config *dynconfig.Watcher[config.Config]
 }
 
-func NewOrderHandler(orderRepo *repository.OrderRepository, queue *messaging.RabbitMQClient) *OrderHandler {
+func NewOrderHandler(
+	orderRepo *repository.OrderRepository,
+	queue *messaging.RabbitMQClient,
+	inventory *inventory.Client,
+	config *dynconfig.Watcher[config.Config],
+) *OrderHandler {
 	return &OrderHandler{
 		orderRepo: orderRepo,
 		queue:     queue,
+		inventory: inventory,
+		config:    config,
 	}
 }
 
-func (h *OrderHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
-
 func (h *OrderHandler) HandleOrders(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
 		h.createOrder(w, r)
 	}
 }
 
-func (h *OrderHandler) HandleInventoryReserved(ctx context.Context, orderID int32, items []*events.OrderItem) (bool, error) {
-	err := h.orderRepo.UpdateOrderStatus(ctx, orderID, "waiting_for_kitchen")
+// HandleInventoryReserved prices the order from the unit prices inventory
+// snapshotted and returns why the order is rejected, or an empty string if
+// it may proceed to the kitchen.
+func (h *OrderHandler) HandleInventoryReserved(ctx context.Context, orderID int32, items []*events.OrderItem) (string, error) {
+	orderItems, err := h.orderRepo.GetOrderItems(ctx, orderID)
 	if err != nil {
-		return false, err
+		return "", err
+	}
+
+	pricing, err := h.priceOrder(orderItems, items)
+	if err != nil {
+		// Pricing the item at 0 would let it through for free.
+		logging.Errorf(ctx, "❌ Order %d can't be priced: %v", orderID, err)
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetTag("order.id", strconv.Itoa(int(orderID)))
+			sentry.CaptureException(err)
+		})
+		return err.Error(), h.orderRepo.UpdateOrderStatus(ctx, orderID, "rejected")
+	}
+
+	status := "waiting_for_kitchen"
+	if pricing.PriceMismatch {
+		logging.Warnf(ctx, "⚠️ Order %d was submitted with prices that differ from inventory", orderID)
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetLevel(sentry.LevelWarning)
+			scope.SetTag("order.id", strconv.Itoa(int(orderID)))
+			scope.SetContext("pricing", map[string]interface{}{
+				"items":    pricing.Items,
+				"subtotal": pricing.Subtotal,
+				"total":    pricing.Total,
+			})
+			sentry.CaptureMessage("Order submitted with mismatched prices")
+		})
+
+		if h.config.Current().RejectPriceMismatch {
+			status = "rejected"
+		}
+	}
+
+	err = h.orderRepo.ApplyOrderPricing(ctx, orderID, pricing, status)
+	if err != nil {
+		return "", err
+	}
+
+	if status == "rejected" {
+		return "submitted prices differ from inventory", nil
+	}
+	return "", nil
+}
+
+// HandleReservationFailed rejects an order inventory couldn't reserve. It
+// isn't priced, since inventory returns no prices for it.
+func (h *OrderHandler) HandleReservationFailed(ctx context.Context, orderID int32, reason string) error {
+	logging.Warnf(ctx, "🚫 Inventory couldn't reserve order %d: %s", orderID, reason)
+	return h.orderRepo.UpdateOrderStatus(ctx, orderID, "rejected")
+}
+
+// priceOrder computes line totals, subtotal, tax and total using the unit
+// prices returned by inventory, and flags any line whose client-submitted
+// price differs from them. An item inventory has no price for is an error.
+func (h *OrderHandler) priceOrder(orderItems []models.OrderItem, reservedItems []*events.OrderItem) (*models.OrderPricing, error) {
+	unitPrices := make(map[int]float64, len(reservedItems))
+	for _, item := range reservedItems {
+		unitPrices[int(item.Id)] = item.UnitPrice
+	}
+
+	pricing := &models.OrderPricing{
+		Items: make([]models.OrderItem, len(orderItems)),
+	}
+	for i, item := range orderItems {
+		unitPrice, ok := unitPrices[item.Id]
+		if !ok {
+			return nil, fmt.Errorf("no inventory price for product %d", item.Id)
+		}
+		if math.Abs(unitPrice-item.Price) >= 0.005 {
+			pricing.PriceMismatch = true
+		}
+
+		item.UnitPrice = unitPrice
+		item.LineTotal = roundCents(unitPrice * float64(item.Quantity))
+		pricing.Subtotal += item.LineTotal
+		pricing.Items[i] = item
 	}
 
-	return true, nil
+	pricing.Subtotal = roundCents(pricing.Subtotal)
+	pricing.Tax = roundCents(pricing.Subtotal * h.config.Current().TaxRate)
+	pricing.Total = roundCents(pricing.Subtotal + pricing.Tax)
+
+	return pricing, nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
 }
 
-func (h *OrderHandler) HandleKitchenAccepted(ctx context.Context, orderID int32) error {
+func (h *OrderHandler) HandleGetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("orderId"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderRepo.GetOrder(r.Context(), int32(orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("order %d not found", orderID), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	order.Items, err = h.orderRepo.GetOrderItems(r.Context(), int32(orderID))
+	if err != nil {
+		sentry.CaptureException(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *OrderHandler) HandleKitchenAccepted(ctx context.Context, orderID int32, estimatedReadyAt time.Time) error {
 	err := h.orderRepo.UpdateOrderStatus(ctx, orderID, "waiting_for_kitchen")
 	if err != nil {
 		return err
 	}
+
+	if estimatedReadyAt.IsZero() {
+		return nil
+	}
+
+	estimatedDeliveryAt := estimatedReadyAt.Add(h.config.Current().DefaultDeliveryTime)
+	return h.orderRepo.UpdateOrderEstimates(ctx, orderID, &estimatedReadyAt, &estimatedDeliveryAt)
+}
+
+func (h *OrderHandler) HandleKitchenRejected(ctx context.Context, orderID int32, reason string) error {
+	logging.Warnf(ctx, "🚫 Kitchen rejected order %d: %s", orderID, reason)
+	err := h.orderRepo.UpdateOrderStatus(ctx, orderID, "rejected_by_kitchen")
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -60,6 +209,14 @@ func (h *OrderHandler) HandleOrderCooked(ctx context.Context, orderID int32) (*m
 		return nil, err
 	}
 
+	// The food is ready now, push the delivery estimate along with it
+	readyAt := time.Now()
+	estimatedDeliveryAt := readyAt.Add(h.config.Current().DefaultDeliveryTime)
+	err = h.orderRepo.UpdateOrderEstimates(ctx, orderID, &readyAt, &estimatedDeliveryAt)
+	if err != nil {
+		return nil, err
+	}
+
 	order, err := h.orderRepo.GetOrder(ctx, orderID)
 	if err != nil {
 		return nil, err
@@ -68,30 +225,69 @@ func (h *OrderHandler) HandleOrderCooked(ctx context.Context, orderID int32) (*m
 	return order, nil
 }
 
-func (h *OrderHandler) HandleDeliveryStarted(ctx context.Context, orderID int32) error {
+func (h *OrderHandler) HandleDeliveryStarted(ctx context.Context, orderID int32, driverID string, estimatedArrivalAt time.Time) error {
 	err := h.orderRepo.UpdateOrderStatus(ctx, orderID, "delivery_started")
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if driverID != "" {
+		err = h.orderRepo.UpdateOrderDriver(ctx, orderID, driverID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if estimatedArrivalAt.IsZero() {
+		return nil
+	}
+
+	return h.orderRepo.UpdateOrderEstimates(ctx, orderID, nil, &estimatedArrivalAt)
+}
+
+// HandleDeliveryFailed moves the order to delivery_failed while the delivery
+// service reattempts it, or to the terminal delivery_returned once it gives
+// up and the food goes back to the kitchen.
+func (h *OrderHandler) HandleDeliveryFailed(ctx context.Context, orderID int32, reason string, attempt int32, willReattempt bool) error {
+	logging.Warnf(ctx, "🚫 Delivery attempt %d of order %d failed: %s", attempt, orderID, reason)
+
+	status := "delivery_returned"
+	if willReattempt {
+		status = "delivery_failed"
+	}
+
+	err := h.orderRepo.UpdateOrderStatus(ctx, orderID, status)
+	if err != nil {
+		return err
+	}
+
+	return h.orderRepo.RecordDeliveryFailure(ctx, orderID, reason, attempt)
 }
 
-func (h *OrderHandler) HandleDeliveryCompleted(ctx context.Context, orderID int32) error {
+func (h *OrderHandler) HandleDeliveryCompleted(ctx context.Context, orderID int32, proof *models.ProofOfDelivery) error {
 	err := h.orderRepo.UpdateOrderStatus(ctx, orderID, "delivery_completed")
 	if err != nil {
 		return err
 	}
-	return nil
+
+	if proof != nil {
+		err = h.orderRepo.RecordProofOfDelivery(ctx, orderID, proof)
+		if err != nil {
+			return err
+		}
+	}
+
+	deliveredAt := time.Now()
+	return h.orderRepo.UpdateOrderEstimates(ctx, orderID, nil, &deliveredAt)
 }
 
 func (h *OrderHandler) createOrder(w http.ResponseWriter, r *http.Request) {
 	sentryTrace := r.Header.Get(sentry.SentryTraceHeader)
 	baggage := r.Header.Get(sentry.SentryBaggageHeader)
 
-	log.Println("sentryTrace: ", sentryTrace)
-	log.Println("baggage: ", baggage)
-
 	ctx := r.Context()
+	logging.Debugf(ctx, "sentryTrace: %s", sentryTrace)
+	logging.Debugf(ctx, "baggage: %s", baggage)
 	hub := sentry.GetHubFromContext(ctx)
 	continueOptions := sentry.ContinueTrace(hub, sentryTrace, baggage)
 
@@ -109,6 +305,29 @@ func (h *OrderHandler) createOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	faults.SetScope(ctx, "customer_id", createOrderReq.CustomerID)
+
+	if h.inventory != nil {
+		checkSpan := transaction.StartChild("function", []sentry.SpanOption{
+			sentry.WithDescription("inventory.CheckAvailability"),
+		}...)
+		shortages, err := h.inventory.CheckAvailability(checkSpan.Context(), createOrderReq.Items)
+		checkSpan.Finish()
+
+		if err != nil {
+			// Inventory still reserves the items when it gets order.created,
+			// so an unreachable inventory service doesn't stop orders.
+			sentry.CaptureException(err)
+			logging.Errorf(ctx, "❌ Skipping availability check: %v", err)
+		} else if len(shortages) > 0 {
+			reasons := make([]string, len(shortages))
+			for i, shortage := range shortages {
+				reasons[i] = shortage.String()
+			}
+			http.Error(w, "❌ Items unavailable: "+strings.Join(reasons, "; "), http.StatusConflict)
+			return
+		}
+	}
 
 	createOrderSpan := transaction.StartChild("function", []sentry.SpanOption{
 		sentry.WithDescription("orderRepo.CreateOrder"),
@@ -0,0 +1,100 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"order/internal/models"
+	"strconv"
+	"strings"
+)
+
+// Client queries the inventory service synchronously. httpClient is
+// expected to resolve the service host through Consul.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// Availability is the current stock of a product.
+type Availability struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Available int     `json:"available"`
+	Price     float64 `json:"price"`
+}
+
+// Shortage is an order item inventory can't currently cover.
+type Shortage struct {
+	ProductID int
+	Requested int
+	Available int
+	Unknown   bool
+}
+
+func (s Shortage) String() string {
+	if s.Unknown {
+		return fmt.Sprintf("product %d not found", s.ProductID)
+	}
+	return fmt.Sprintf("insufficient quantity for product %d (requested: %d, available: %d)", s.ProductID, s.Requested, s.Available)
+}
+
+func NewClient(httpClient *http.Client, service string) *Client {
+	return &Client{httpClient: httpClient, baseURL: "http://" + service}
+}
+
+// CheckAvailability returns the items that couldn't be reserved right now.
+// It's only a pre-check: stock can still run out before the order.created
+// event reaches inventory, which makes the actual reservation.
+func (c *Client) CheckAvailability(ctx context.Context, items []models.OrderItem) ([]Shortage, error) {
+	requested := map[int]int{}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if _, ok := requested[item.Id]; !ok {
+			ids = append(ids, strconv.Itoa(item.Id))
+		}
+		requested[item.Id] += item.Quantity
+	}
+
+	endpoint := c.baseURL + "/products/availability?ids=" + url.QueryEscape(strings.Join(ids, ","))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Failed to check availability: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("❌ Failed to check availability: inventory responded %s", resp.Status)
+	}
+
+	var products []Availability
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("❌ Invalid availability response: %w", err)
+	}
+
+	available := map[string]int{}
+	for _, product := range products {
+		available[product.ID] = product.Available
+	}
+
+	var shortages []Shortage
+	for _, id := range ids {
+		productID, _ := strconv.Atoi(id)
+		stock, ok := available[id]
+		switch {
+		case !ok:
+			shortages = append(shortages, Shortage{ProductID: productID, Requested: requested[productID], Unknown: true})
+		case stock < requested[productID]:
+			shortages = append(shortages, Shortage{ProductID: productID, Requested: requested[productID], Available: stock})
+		}
+	}
+
+	return shortages, nil
+}
@@ -13,8 +13,23 @@ type OrderBase struct {
 type Order struct {
 	Id int `db:"id,primary_key,autoincrement"`
 	OrderBase
-	CreatedAt time.Time   `db:"created_at"`
-	Items     []OrderItem `db:"items"`
+	Subtotal              float64     `db:"subtotal"`
+	Tax                   float64     `db:"tax"`
+	Total                 float64     `db:"total"`
+	PriceMismatch         bool        `db:"price_mismatch"`
+	EstimatedReadyAt      *time.Time  `db:"estimated_ready_at"`
+	EstimatedDeliveryAt   *time.Time  `db:"estimated_delivery_at"`
+	DriverID              *string     `db:"driver_id"`
+	DeliveryAttempts      int         `db:"delivery_attempts"`
+	DeliveryFailureReason *string     `db:"delivery_failure_reason"`
+	ProofRecipientName    *string     `db:"proof_recipient_name"`
+	ProofKind             *string     `db:"proof_kind"`
+	ProofURL              *string     `db:"proof_url"`
+	ProofLatitude         *float64    `db:"proof_latitude"`
+	ProofLongitude        *float64    `db:"proof_longitude"`
+	ProofCapturedAt       *time.Time  `db:"proof_captured_at"`
+	CreatedAt             time.Time   `db:"created_at"`
+	Items                 []OrderItem `db:"items"`
 }
 
 type CreateOrderRequest struct {
@@ -23,8 +38,32 @@ type CreateOrderRequest struct {
 }
 
 type OrderItem struct {
-	Id       int     `db:"id"`
-	Name     string  `db:"name"`
-	Quantity int     `db:"quantity"`
-	Price    float64 `db:"price"`
+	Id        int     `db:"id"`
+	Name      string  `db:"name"`
+	Quantity  int     `db:"quantity"`
+	Price     float64 `db:"price"`      // as submitted by the client
+	UnitPrice float64 `db:"unit_price"` // as snapshotted by inventory
+	LineTotal float64 `db:"line_total"`
+}
+
+// ProofOfDelivery is the evidence the delivery service collected when the
+// order was handed over. The photo or signature itself stays in the delivery
+// service, behind URL.
+type ProofOfDelivery struct {
+	RecipientName string
+	Kind          string
+	URL           string
+	Latitude      float64
+	Longitude     float64
+	CapturedAt    time.Time
+}
+
+// OrderPricing is the authoritative pricing of an order, computed from the
+// unit prices inventory returned when it reserved the items.
+type OrderPricing struct {
+	Items         []OrderItem
+	Subtotal      float64
+	Tax           float64
+	Total         float64
+	PriceMismatch bool
 }
@@ -0,0 +1,95 @@
+// Package amqptrace publishes and consumes AMQP messages in queue.publish
+// and queue.process spans that follow the messaging conventions Sentry's
+// queue monitoring and OpenTelemetry expect. Every service goes through it,
+// so trace headers are always injected from the publish span and extracted
+// into the process transaction the same way.
+package amqptrace
+
+import (
+	"context"
+	"order/internal/platform/faults"
+	"order/internal/platform/metrics"
+	"order/internal/platform/tracing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	system = "rabbitmq"
+	origin = sentry.SpanOrigin("auto.queue.amqptrace")
+)
+
+// Channel is the part of *amqp.Channel a Publisher needs.
+type Channel interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Publisher publishes messages in queue.publish spans.
+type Publisher struct {
+	channel Channel
+}
+
+func NewPublisher(channel Channel) *Publisher {
+	return &Publisher{channel: channel}
+}
+
+// Publish sends msg to exchange with routing key in a queue.publish span,
+// which the message's trace headers continue from. data is added to the
+// span. Messages without a Timestamp get the current time, so consumers can
+// tell how long they waited.
+func (p *Publisher) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing, data map[string]interface{}) error {
+	span := tracing.StartSpan(ctx, "queue.publish", key)
+	defer span.Finish()
+	span.Origin = origin
+
+	span.SetData("messaging.system", system)
+	span.SetData("messaging.operation", "publish")
+	span.SetData("messaging.destination.name", exchange)
+	span.SetData("messaging.destination.routing_key", key)
+	span.SetData("messaging.message.id", msg.MessageId)
+	span.SetData("messaging.message.body.size", len(msg.Body))
+	for key, value := range data {
+		span.SetData(key, value)
+	}
+
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	tracing.Inject(span.Context(), tracing.TableCarrier(headers))
+	msg.Headers = headers
+
+	err := faults.Inject(span.Context(), faults.PointPublish, key)
+	if err == nil {
+		err = p.channel.PublishWithContext(span.Context(), exchange, key, false, false, msg)
+	}
+	metrics.MessagePublished(exchange, key, err)
+	if err != nil {
+		span.SetError(err)
+	}
+	return err
+}
+
+// Encode marshals event in a serialize span.
+func Encode(ctx context.Context, event proto.Message) ([]byte, error) {
+	span := tracing.StartSpan(ctx, "serialize", "proto.Marshal")
+	defer span.Finish()
+	span.SetData("event.name", eventName(event))
+
+	payload, err := proto.Marshal(event)
+	if err != nil {
+		span.SetError(err)
+	}
+	return payload, err
+}
+
+func eventName(event proto.Message) string {
+	return string(event.ProtoReflect().Descriptor().Name())
+}
@@ -0,0 +1,192 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	sentryFlushTimeout     = 2 * time.Second
+)
+
+// Manager owns the process lifecycle: it serves HTTP, runs the message
+// consumers and, on SIGINT/SIGTERM, tears everything down in order:
+//
+//  1. deregister from Consul so no new traffic is routed here
+//  2. stop accepting HTTP requests and drain the in-flight ones
+//  3. cancel the consumers and background tasks and wait for them to return
+//  4. close the AMQP connection
+//  5. flush buffered Sentry events
+//
+// Steps 2 and 3 share the SHUTDOWN_TIMEOUT deadline (30s by default).
+type Manager struct {
+	server          *http.Server
+	shutdownTimeout time.Duration
+
+	consumerCtx     context.Context
+	cancelConsumers context.CancelFunc
+	consumers       sync.WaitGroup
+
+	mu           sync.Mutex
+	shuttingDown bool
+	deregister   func() error
+	closers      []func()
+}
+
+func New(server *http.Server) *Manager {
+	shutdownTimeout := defaultShutdownTimeout
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("❌ Invalid SHUTDOWN_TIMEOUT %q, using %s", value, defaultShutdownTimeout)
+		} else {
+			shutdownTimeout = parsed
+		}
+	}
+
+	consumerCtx, cancelConsumers := context.WithCancel(context.Background())
+
+	return &Manager{
+		server:          server,
+		shutdownTimeout: shutdownTimeout,
+		consumerCtx:     consumerCtx,
+		cancelConsumers: cancelConsumers,
+	}
+}
+
+// Go runs a background worker, such as a message consumer or a config
+// watcher. Its context is cancelled during shutdown and the manager waits for
+// it to return before closing AMQP.
+func (m *Manager) Go(name string, consume func(ctx context.Context) error) {
+	m.consumers.Add(1)
+	go func() {
+		defer m.consumers.Done()
+		if err := consume(m.consumerCtx); err != nil {
+			log.Printf("❌ %s stopped: %v", name, err)
+			return
+		}
+		log.Printf("✋ %s stopped", name)
+	}()
+}
+
+// Spawn runs a background task, such as cooking an order, in its own
+// goroutine. Like a worker started with Go, its context is cancelled during
+// shutdown and the manager waits for it to return before closing AMQP.
+func (m *Manager) Spawn(task func(ctx context.Context)) {
+	m.consumers.Add(1)
+	go func() {
+		defer m.consumers.Done()
+		task(m.consumerCtx)
+	}()
+}
+
+// SetRegistration records how to deregister from Consul. Registration
+// happens asynchronously, so if shutdown has already started the instance
+// is deregistered straight away.
+func (m *Manager) SetRegistration(deregister func() error) {
+	m.mu.Lock()
+	if !m.shuttingDown {
+		m.deregister = deregister
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+
+	if err := deregister(); err != nil {
+		log.Println(err)
+	}
+}
+
+// OnClose registers a function that runs once the consumers have stopped,
+// such as closing the AMQP connection. Closers run in reverse order.
+func (m *Manager) OnClose(close func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, close)
+}
+
+// Run serves HTTP until the process is signalled or the server fails, then
+// shuts down. It returns the server error, if any.
+func (m *Manager) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", m.server.Addr)
+		if err := m.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Println("✋ Received shutdown signal")
+	case err = <-serverErr:
+		log.Printf("❌ HTTP server failed: %v", err)
+	}
+
+	// A second signal while shutting down kills the process immediately.
+	stop()
+
+	m.shutdown()
+	return err
+}
+
+func (m *Manager) shutdown() {
+	m.mu.Lock()
+	m.shuttingDown = true
+	deregister := m.deregister
+	closers := m.closers
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	if deregister != nil {
+		if err := deregister(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := m.server.Shutdown(ctx); err != nil {
+		log.Printf("❌ HTTP server shutdown: %v", err)
+	} else {
+		log.Println("✅ HTTP server stopped")
+	}
+
+	m.cancelConsumers()
+	done := make(chan struct{})
+	go func() {
+		m.consumers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("✅ Consumers stopped")
+	case <-ctx.Done():
+		log.Println("❌ Timed out waiting for consumers to stop")
+	}
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i]()
+	}
+
+	if !sentry.Flush(sentryFlushTimeout) {
+		log.Println("❌ Timed out flushing Sentry events")
+	}
+
+	log.Println("✅ Shutdown complete")
+}
@@ -0,0 +1,339 @@
+// Package sqltrace wraps sqlx so every query runs in a db.sql.execute span
+// with the db.* data set, the normalized statement as its description, the
+// rows it affected or returned and its error. Spans of queries returning
+// Rows stay open until the rows are read or closed. Only the context-aware
+// calls are exposed, so cancellation always reaches the database.
+//
+// Queries slower than Options.SlowQueryThreshold are explained and reported
+// to Sentry, and so are statements repeated within a transaction, the
+// telltale of an N+1 loop.
+package sqltrace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"order/internal/platform/faults"
+	"order/internal/platform/tracing"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DB is a traced *sqlx.DB.
+type DB struct {
+	db      *sqlx.DB
+	system  string
+	name    string
+	options Options
+
+	// explained holds when each statement was last explained, so a query
+	// that's always slow isn't explained on every call.
+	explained sync.Map
+}
+
+// New wraps db. system and name are the db.system and db.name of its spans,
+// e.g. "postgresql" and the database name from NameFromURL.
+func New(db *sqlx.DB, system, name string, options Options) *DB {
+	return &DB{db: db, system: system, name: name, options: options}
+}
+
+// Tx is a traced *sqlx.Tx.
+type Tx struct {
+	tx *sqlx.Tx
+	db *DB
+
+	mu sync.Mutex
+	// executions counts how often each statement ran in the transaction.
+	executions map[string]int
+}
+
+// querier is what DB and Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return execContext(ctx, d.start(ctx, nil, query, args), d.db)
+}
+
+func (d *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return queryxContext(ctx, d.start(ctx, nil, query, args), d.db)
+}
+
+func (d *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return getContext(ctx, d.start(ctx, nil, query, args), d.db, dest)
+}
+
+func (d *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectContext(ctx, d.start(ctx, nil, query, args), d.db, dest)
+}
+
+// NamedQueryContext runs a query with :name parameters bound from arg.
+func (d *DB) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*Rows, error) {
+	return namedQueryContext(ctx, d.start(ctx, nil, query, nil), d.db, arg)
+}
+
+// BeginTxx starts a transaction; its queries are traced like the DB's.
+func (d *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := d.db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, db: d, executions: map[string]int{}}, nil
+}
+
+// PingContext checks the connection without a span; it's only used by
+// health checks, which would flood traces.
+func (d *DB) PingContext(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
+// Unwrap returns the underlying database, for the few callers that need it
+// directly, such as migrations.
+func (d *DB) Unwrap() *sqlx.DB {
+	return d.db
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return execContext(ctx, t.db.start(ctx, t, query, args), t.tx)
+}
+
+func (t *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return queryxContext(ctx, t.db.start(ctx, t, query, args), t.tx)
+}
+
+func (t *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return getContext(ctx, t.db.start(ctx, t, query, args), t.tx, dest)
+}
+
+func (t *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return selectContext(ctx, t.db.start(ctx, t, query, args), t.tx, dest)
+}
+
+// NamedQueryContext runs a query with :name parameters bound from arg.
+func (t *Tx) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*Rows, error) {
+	return namedQueryContext(ctx, t.db.start(ctx, t, query, nil), t.tx, arg)
+}
+
+func (t *Tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// count records another execution of statement and returns how many there
+// have been in the transaction.
+func (t *Tx) count(statement string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.executions[statement]++
+	return t.executions[statement]
+}
+
+// call is a query in progress.
+type call struct {
+	ctx       context.Context
+	span      *tracing.Span
+	query     string
+	statement string
+	args      []interface{}
+	// namedArg is set instead of args for queries with :name parameters.
+	namedArg interface{}
+	start    time.Time
+	db       *DB
+	// fault is an error injected in place of running the query.
+	fault error
+}
+
+func (d *DB) start(ctx context.Context, tx *Tx, query string, args []interface{}) *call {
+	statement := Normalize(query)
+
+	span := tracing.StartSpan(ctx, "db.sql.execute", statement)
+	span.SetData("db.system", d.system)
+	span.SetData("db.name", d.name)
+	span.SetData("db.statement", statement)
+	span.SetData("db.operation", Operation(statement))
+	table := Table(statement)
+	if table != "" {
+		span.SetData("db.sql.table", table)
+	}
+
+	c := &call{
+		ctx:       ctx,
+		span:      span,
+		query:     query,
+		statement: statement,
+		args:      args,
+		start:     time.Now(),
+		db:        d,
+	}
+
+	c.fault = faults.Inject(span.Context(), faults.PointDB, table)
+
+	if tx != nil && d.options.NPlusOneThreshold > 0 {
+		if executions := tx.count(statement); executions == d.options.NPlusOneThreshold {
+			d.reportNPlusOne(c, executions)
+		}
+	}
+
+	return c
+}
+
+// finish ends the span, reporting the query first if it was slow.
+func (c *call) finish() {
+	if threshold := c.db.options.SlowQueryThreshold; threshold > 0 {
+		if duration := time.Since(c.start); duration >= threshold {
+			c.db.reportSlowQuery(c, duration)
+		}
+	}
+	c.span.Finish()
+}
+
+func (c *call) fail(err error) {
+	if err != nil {
+		c.span.SetError(err)
+	}
+}
+
+func execContext(ctx context.Context, c *call, q querier) (sql.Result, error) {
+	defer c.finish()
+
+	if c.fault != nil {
+		c.fail(c.fault)
+		return nil, c.fault
+	}
+
+	result, err := q.ExecContext(ctx, c.query, c.args...)
+	if err != nil {
+		c.fail(err)
+		return nil, err
+	}
+
+	if rows, err := result.RowsAffected(); err == nil {
+		c.span.SetData("db.rows_affected", rows)
+	}
+	return result, nil
+}
+
+func queryxContext(ctx context.Context, c *call, q querier) (*Rows, error) {
+	if c.fault != nil {
+		c.fail(c.fault)
+		c.finish()
+		return nil, c.fault
+	}
+
+	rows, err := q.QueryxContext(ctx, c.query, c.args...)
+	if err != nil {
+		c.fail(err)
+		c.finish()
+		return nil, err
+	}
+	return &Rows{Rows: rows, call: c}, nil
+}
+
+func getContext(ctx context.Context, c *call, q querier, dest interface{}) error {
+	defer c.finish()
+
+	if c.fault != nil {
+		c.fail(c.fault)
+		return c.fault
+	}
+
+	err := q.GetContext(ctx, dest, c.query, c.args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Not finding a row is an answer, not a failure of the query.
+		c.span.SetData("db.rows_affected", 0)
+	case err != nil:
+		c.fail(err)
+	default:
+		c.span.SetData("db.rows_affected", 1)
+	}
+	return err
+}
+
+func selectContext(ctx context.Context, c *call, q querier, dest interface{}) error {
+	defer c.finish()
+
+	if c.fault != nil {
+		c.fail(c.fault)
+		return c.fault
+	}
+
+	err := q.SelectContext(ctx, dest, c.query, c.args...)
+	if err != nil {
+		c.fail(err)
+		return err
+	}
+
+	if value := reflect.Indirect(reflect.ValueOf(dest)); value.Kind() == reflect.Slice {
+		c.span.SetData("db.rows_affected", value.Len())
+	}
+	return nil
+}
+
+func namedQueryContext(ctx context.Context, c *call, e sqlx.ExtContext, arg interface{}) (*Rows, error) {
+	c.namedArg = arg
+
+	if c.fault != nil {
+		c.fail(c.fault)
+		c.finish()
+		return nil, c.fault
+	}
+
+	rows, err := sqlx.NamedQueryContext(ctx, e, c.query, arg)
+	if err != nil {
+		c.fail(err)
+		c.finish()
+		return nil, err
+	}
+	return &Rows{Rows: rows, call: c}, nil
+}
+
+// Rows are the traced results of a query. The query's span finishes once
+// Next runs out of rows or Close is called, with the rows read so far and
+// the error that stopped them, so it covers reading the results as well as
+// running the query. Close them as with *sqlx.Rows.
+type Rows struct {
+	*sqlx.Rows
+	call *call
+
+	read     int
+	finished sync.Once
+}
+
+// Next prepares the next row, finishing the span when there is none.
+func (r *Rows) Next() bool {
+	if !r.Rows.Next() {
+		r.finish()
+		return false
+	}
+	r.read++
+	return true
+}
+
+// Close closes the rows and finishes the span.
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.finish()
+	return err
+}
+
+func (r *Rows) finish() {
+	r.finished.Do(func() {
+		if err := r.Rows.Err(); err != nil {
+			r.call.fail(err)
+		} else {
+			r.call.span.SetData("db.rows_affected", r.read)
+		}
+		r.call.finish()
+	})
+}
@@ -0,0 +1,148 @@
+// Package otlpmem is an in-memory OTLP/HTTP trace collector. Point a
+// service's OTEL_EXPORTER_OTLP_ENDPOINT at it to check which spans the
+// exporter sends without running a real collector.
+package otlpmem
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Span is a received span, flattened for easy assertions.
+type Span struct {
+	Service      string
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Attributes   map[string]string
+}
+
+// Collector accepts OTLP/HTTP protobuf trace exports on /v1/traces.
+type Collector struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewCollector starts a collector on a local port.
+func NewCollector() *Collector {
+	c := &Collector{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", c.handleTraces)
+	c.server = httptest.NewServer(mux)
+	return c
+}
+
+// Endpoint is the URL to export to, suitable for
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT.
+func (c *Collector) Endpoint() string {
+	return c.server.URL + "/v1/traces"
+}
+
+// Spans returns the spans received so far.
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Reset forgets the spans received so far.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = nil
+}
+
+func (c *Collector) Close() {
+	c.server.Close()
+}
+
+func (c *Collector) handleTraces(w http.ResponseWriter, r *http.Request) {
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(payload, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var received []Span
+	for _, resourceSpans := range request.ResourceSpans {
+		service := attributes(resourceSpans.GetResource().GetAttributes())["service.name"]
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				received = append(received, Span{
+					Service:      service,
+					Name:         span.Name,
+					TraceID:      hex.EncodeToString(span.TraceId),
+					SpanID:       hex.EncodeToString(span.SpanId),
+					ParentSpanID: hex.EncodeToString(span.ParentSpanId),
+					Attributes:   attributes(span.Attributes),
+				})
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.spans = append(c.spans, received...)
+	c.mu.Unlock()
+
+	response, err := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(response)
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	values := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		values[kv.Key] = anyValue(kv.Value)
+	}
+	return values
+}
+
+func anyValue(value *commonpb.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return value.String()
+	}
+}
@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "order/internal/platform/tracing"
+
+// Span is a span recorded in Sentry and, when it's set up, in OpenTelemetry.
+// The Sentry span is embedded so existing code can keep using StartChild,
+// Origin, Status and friends; SetData and Finish apply to both.
+type Span struct {
+	*sentry.Span
+	otel trace.Span
+}
+
+// StartSpan starts a span as a child of the span in ctx, or as a new trace
+// if there is none. Use Context() on the result to parent further spans.
+func StartSpan(ctx context.Context, op, description string) *Span {
+	ctx, otelSpan := tracer().Start(ctx, otelName(op, description),
+		trace.WithSpanKind(kindFor(op)),
+		trace.WithAttributes(attribute.String("sentry.op", op)),
+	)
+
+	sentrySpan := sentry.StartSpan(ctx, op, sentry.WithDescription(description))
+
+	return &Span{Span: sentrySpan, otel: otelSpan}
+}
+
+// StartTransaction starts the root span of a unit of work, such as
+// processing a message, continuing the trace found in carrier. Both the
+// sentry-trace/baggage and traceparent headers are understood.
+func StartTransaction(ctx context.Context, name string, carrier propagation.TextMapCarrier) *Span {
+	ctx = propagator.Extract(ctx, carrier)
+	remote := trace.SpanContextFromContext(ctx)
+	ctx, otelSpan := tracer().Start(ctx, name,
+		trace.WithSpanKind(kindFor(name)),
+		trace.WithAttributes(attribute.String("sentry.op", name)),
+	)
+
+	options := []sentry.SpanOption{
+		sentry.ContinueFromHeaders(carrier.Get(sentry.SentryTraceHeader), carrier.Get(sentry.SentryBaggageHeader)),
+	}
+	// Without sentry-trace, such as from a W3C-only caller, Sentry takes the
+	// trace OpenTelemetry is in, so both record the same one.
+	if carrier.Get(sentry.SentryTraceHeader) == "" && otelSpan.SpanContext().HasTraceID() {
+		options = append(options, func(span *sentry.Span) {
+			span.TraceID = sentry.TraceID(otelSpan.SpanContext().TraceID())
+			if remote.IsValid() {
+				span.ParentSpanID = sentry.SpanID(remote.SpanID())
+			}
+		})
+	}
+	sentrySpan := sentry.StartTransaction(ctx, name, options...)
+
+	return &Span{Span: sentrySpan, otel: otelSpan}
+}
+
+// SetData records an attribute on the span.
+func (s *Span) SetData(key string, value interface{}) {
+	s.Span.SetData(key, value)
+	s.otel.SetAttributes(attributeFor(key, value))
+}
+
+// Tag sets a tag on the spans active in ctx, for code that doesn't hold the
+// *Span. OpenTelemetry gets it as an attribute.
+func Tag(ctx context.Context, key, value string) {
+	if span := sentry.SpanFromContext(ctx); span != nil {
+		span.SetTag(key, value)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(key, value))
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	s.Span.Status = sentry.SpanStatusInternalError
+	s.otel.RecordError(err)
+	s.otel.SetStatus(codes.Error, err.Error())
+}
+
+// Finish ends the span.
+func (s *Span) Finish() {
+	s.FinishAt(time.Now())
+}
+
+// FinishAt ends the span as of end, for work that is followed up on after
+// the fact, such as explaining a slow query.
+func (s *Span) FinishAt(end time.Time) {
+	if status := s.Span.Status; status != sentry.SpanStatusUndefined && status != sentry.SpanStatusOK {
+		s.otel.SetStatus(codes.Error, status.String())
+	}
+	s.Span.EndTime = end
+	s.Span.Finish()
+	s.otel.End(trace.WithTimestamp(end))
+
+	if hooks := finishHooks.Load(); hooks != nil {
+		for _, hook := range *hooks {
+			hook(s.Span)
+		}
+	}
+}
+
+var finishHooks atomic.Pointer[[]func(*sentry.Span)]
+
+// OnFinish registers fn to be called with every span started by this package
+// once it finishes, e.g. to derive metrics from span data. Register hooks at
+// startup; they run on the finishing goroutine and must be quick.
+func OnFinish(fn func(*sentry.Span)) {
+	var hooks []func(*sentry.Span)
+	if current := finishHooks.Load(); current != nil {
+		hooks = append(hooks, *current...)
+	}
+	hooks = append(hooks, fn)
+	finishHooks.Store(&hooks)
+}
+
+// TraceID returns the trace id of the span, preferring OpenTelemetry's when
+// both backends run since it's the one collectors index by.
+func (s *Span) TraceID() string {
+	// Without a tracer provider the OpenTelemetry span only carries the
+	// caller's ids, so it isn't worth reporting.
+	if s.otel.IsRecording() {
+		return s.otel.SpanContext().TraceID().String()
+	}
+	return s.Span.TraceID.String()
+}
+
+// IDs returns the trace and span ids of the span in ctx, with the same
+// preference as TraceID. Both are empty when ctx has no span.
+func IDs(ctx context.Context) (traceID, spanID string) {
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		return span.SpanContext().TraceID().String(), span.SpanContext().SpanID().String()
+	}
+	if span := sentry.SpanFromContext(ctx); span != nil {
+		return span.TraceID.String(), span.SpanID.String()
+	}
+	return "", ""
+}
+
+// Inject writes the trace headers of the span in ctx to carrier:
+// sentry-trace and baggage for Sentry, traceparent and tracestate for
+// everything that speaks W3C Trace Context.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if span := sentry.SpanFromContext(ctx); span != nil {
+		carrier.Set(sentry.SentryTraceHeader, span.ToSentryTrace())
+		if baggage := span.ToBaggage(); baggage != "" {
+			carrier.Set(sentry.SentryBaggageHeader, baggage)
+		}
+	}
+	propagator.Inject(ctx, carrier)
+}
+
+// propagator only handles Trace Context. W3C baggage shares its header with
+// Sentry's dynamic sampling context, which Inject writes itself.
+var propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+func otelName(op, description string) string {
+	if description == "" {
+		return op
+	}
+	return description
+}
+
+func kindFor(op string) trace.SpanKind {
+	switch {
+	case op == "http.server":
+		return trace.SpanKindServer
+	case op == "http.client", strings.HasPrefix(op, "db"):
+		return trace.SpanKindClient
+	case op == "queue.publish":
+		return trace.SpanKindProducer
+	case op == "queue.process":
+		return trace.SpanKindConsumer
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+func attributeFor(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// orderStatusTransitions counts orders moving between statuses. Summed by
+// "to", it gives the funnel from pending to delivery_completed.
+var orderStatusTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "order_status_transitions_total",
+	Help: "Orders moved from one status to another. New orders come from \"none\".",
+}, []string{"from", "to"})
+
+func recordStatusTransition(from, to string) {
+	// Redelivered events set the status the order already has.
+	if from == to {
+		return
+	}
+	if from == "" {
+		from = "none"
+	}
+	orderStatusTransitions.WithLabelValues(from, to).Inc()
+}
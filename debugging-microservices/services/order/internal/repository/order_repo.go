@@ -2,12 +2,15 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"log"
 	"order/internal/models"
+	"order/internal/platform/logging"
+	"order/internal/platform/sqltrace"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -19,7 +22,7 @@ import (
 )
 
 type OrderRepository struct {
-	db *sqlx.DB
+	db *sqltrace.DB
 }
 
 // Make a migration file: migrate create -ext sql -dir migrations -seq [name]
@@ -35,7 +38,7 @@ func NewOrderRepository() (*OrderRepository, error) {
 	}
 
 	// Run migrations
-	log.Println("♻️ Running migrations...")
+	logging.Infof(context.Background(), "♻️ Running migrations...")
 	driver, err := postgres.WithInstance(conn.DB, &postgres.Config{})
 	if err != nil {
 		return nil, err
@@ -61,27 +64,22 @@ func NewOrderRepository() (*OrderRepository, error) {
 		return nil, err
 	}
 
-	log.Println("✅ Migrations completed")
+	logging.Infof(context.Background(), "✅ Migrations completed")
 
-	return &OrderRepository{db: conn}, nil
+	options, err := sqltrace.OptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return &OrderRepository{db: sqltrace.New(conn, "postgresql", sqltrace.NameFromURL(dbUrl), options)}, nil
 }
 
 func (r *OrderRepository) GetOrder(ctx context.Context, orderID int32) (*models.Order, error) {
-	parentSpan := sentry.SpanFromContext(ctx)
-
 	var order models.Order
 
 	query := "SELECT * FROM orders WHERE id = $1"
 
-	selectOrderSpan := parentSpan.StartChild("db.sql.execute", []sentry.SpanOption{
-		sentry.WithDescription(query),
-	}...)
-	selectOrderSpan.SetData("db.system", "postgresql")
-	selectOrderSpan.SetData("db.operation", "SELECT")
-	selectOrderSpan.SetData("db.name", "orders")
-
-	err := r.db.Get(&order, query, orderID)
-	selectOrderSpan.Finish()
+	err := r.db.GetContext(ctx, &order, query, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -89,32 +87,125 @@ func (r *OrderRepository) GetOrder(ctx context.Context, orderID int32) (*models.
 	return &order, nil
 }
 
-func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID int32, status string) error {
-	parentSpan := sentry.SpanFromContext(ctx)
+func (r *OrderRepository) GetOrderItems(ctx context.Context, orderID int32) ([]models.OrderItem, error) {
+	var items []models.OrderItem
 
-	query := "UPDATE orders SET status = $1 WHERE id = $2"
+	query := "SELECT product_id AS id, name, quantity, price, unit_price, line_total FROM order_items WHERE order_id = $1 ORDER BY id"
 
-	insertOrderSpan := parentSpan.StartChild("db.sql.execute", []sentry.SpanOption{
-		sentry.WithDescription(query),
-	}...)
-	insertOrderSpan.SetData("db.system", "postgresql")
-	insertOrderSpan.SetData("db.operation", "UPDATE")
-	insertOrderSpan.SetData("db.name", "orders")
+	err := r.db.SelectContext(ctx, &items, query, orderID)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := r.db.Exec(query, status, orderID)
-	insertOrderSpan.Finish()
+	return items, nil
+}
 
+// ApplyOrderPricing stores the authoritative line prices and totals of an
+// order and moves it to the given status in a single transaction.
+func (r *OrderRepository) ApplyOrderPricing(ctx context.Context, orderID int32, pricing *models.OrderPricing, status string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	query := "UPDATE order_items SET unit_price = $1, line_total = $2 WHERE order_id = $3 AND product_id = $4"
+	for _, item := range pricing.Items {
+		_, err = tx.ExecContext(ctx, query, item.UnitPrice, item.LineTotal, orderID, strconv.Itoa(item.Id))
+		if err != nil {
+			return err
+		}
+	}
 
+	query = `
+		UPDATE orders SET subtotal = $1, tax = $2, total = $3, price_mismatch = $4, status = $5
+		FROM (SELECT id, status FROM orders WHERE id = $6 FOR UPDATE) AS previous
+		WHERE orders.id = previous.id
+		RETURNING previous.status
+	`
+	var previousStatus string
+	err = tx.GetContext(ctx, &previousStatus, query, pricing.Subtotal, pricing.Tax, pricing.Total, pricing.PriceMismatch, status, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordStatusTransition(previousStatus, status)
 	return nil
 }
 
-func (r *OrderRepository) CreateOrder(ctx context.Context, req *models.CreateOrderRequest) (*models.Order, error) {
-	parentSpan := sentry.SpanFromContext(ctx)
+func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID int32, status string) error {
+	// The previous status is returned for the status transition metrics.
+	query := `
+		UPDATE orders SET status = $1
+		FROM (SELECT id, status FROM orders WHERE id = $2 FOR UPDATE) AS previous
+		WHERE orders.id = previous.id
+		RETURNING previous.status
+	`
+
+	var previousStatus string
+	err := r.db.GetContext(ctx, &previousStatus, query, status, orderID)
 
-	tx, err := r.db.Beginx()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	recordStatusTransition(previousStatus, status)
+	return nil
+}
+
+// UpdateOrderEstimates stores the latest ready and delivery estimates of an
+// order. A nil estimate keeps the one already stored.
+func (r *OrderRepository) UpdateOrderEstimates(ctx context.Context, orderID int32, estimatedReadyAt, estimatedDeliveryAt *time.Time) error {
+	query := "UPDATE orders SET estimated_ready_at = COALESCE($1, estimated_ready_at), estimated_delivery_at = COALESCE($2, estimated_delivery_at) WHERE id = $3"
+
+	_, err := r.db.ExecContext(ctx, query, estimatedReadyAt, estimatedDeliveryAt, orderID)
+
+	return err
+}
+
+func (r *OrderRepository) UpdateOrderDriver(ctx context.Context, orderID int32, driverID string) error {
+	query := "UPDATE orders SET driver_id = $1 WHERE id = $2"
+
+	_, err := r.db.ExecContext(ctx, query, driverID, orderID)
+
+	return err
+}
+
+// RecordDeliveryFailure stores why the latest delivery attempt of an order
+// failed and how many attempts were made so far.
+func (r *OrderRepository) RecordDeliveryFailure(ctx context.Context, orderID int32, reason string, attempts int32) error {
+	query := "UPDATE orders SET delivery_failure_reason = $1, delivery_attempts = GREATEST(delivery_attempts, $2) WHERE id = $3"
+
+	_, err := r.db.ExecContext(ctx, query, reason, attempts, orderID)
+
+	return err
+}
+
+func (r *OrderRepository) RecordProofOfDelivery(ctx context.Context, orderID int32, proof *models.ProofOfDelivery) error {
+	query := `
+		UPDATE orders SET proof_recipient_name = $1, proof_kind = $2, proof_url = $3,
+			proof_latitude = $4, proof_longitude = $5, proof_captured_at = $6
+		WHERE id = $7
+	`
+
+	_, err := r.db.ExecContext(ctx, query, proof.RecipientName, proof.Kind, proof.URL,
+		proof.Latitude, proof.Longitude, proof.CapturedAt, orderID)
+
+	return err
+}
+
+func (r *OrderRepository) CreateOrder(ctx context.Context, req *models.CreateOrderRequest) (*models.Order, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -133,37 +224,48 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, req *models.CreateOrd
 		RETURNING id
 	`
 
-	insertOrderSpan := parentSpan.StartChild("db.sql.execute", []sentry.SpanOption{
-		sentry.WithDescription(query),
-	}...)
-	insertOrderSpan.SetData("db.system", "postgresql")
-	insertOrderSpan.SetData("db.operation", "INSERT")
-	insertOrderSpan.SetData("db.name", "orders")
-	defer insertOrderSpan.Finish()
-
-	rows, err := tx.NamedQuery(query, order)
+	rows, err := tx.NamedQueryContext(ctx, query, order)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	if !rows.Next() {
+		rows.Close()
 		err = errors.New("no order created")
 		sentry.CaptureException(err)
 		return nil, err
 	}
 
 	err = rows.Scan(&order.Id)
+	rows.Close()
 	if err != nil {
 		sentry.CaptureException(err)
 		return nil, err
 	}
 
+	query = `
+		INSERT INTO order_items (order_id, product_id, name, quantity, price)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	for _, item := range order.Items {
+		_, err = tx.ExecContext(ctx, query, order.Id, item.Id, item.Name, item.Quantity, item.Price)
+		if err != nil {
+			sentry.CaptureException(err)
+			return nil, err
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		sentry.CaptureException(err)
 		return nil, err
 	}
 
+	recordStatusTransition("", order.Status)
 	return order, nil
 }
+
+// Ping checks that the database is reachable, for the readiness check.
+func (r *OrderRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
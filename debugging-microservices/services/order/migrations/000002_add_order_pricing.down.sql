@@ -0,0 +1,9 @@
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS line_total,
+    DROP COLUMN IF EXISTS unit_price;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS price_mismatch,
+    DROP COLUMN IF EXISTS total,
+    DROP COLUMN IF EXISTS tax,
+    DROP COLUMN IF EXISTS subtotal;
\ No newline at end of file
@@ -0,0 +1,10 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS total DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS price_mismatch BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- price holds what the client submitted, unit_price is the snapshot from inventory
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS unit_price DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS line_total DECIMAL(10,2) NOT NULL DEFAULT 0;
\ No newline at end of file
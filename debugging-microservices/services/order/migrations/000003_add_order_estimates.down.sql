@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS estimated_delivery_at,
+    DROP COLUMN IF EXISTS estimated_ready_at;
\ No newline at end of file
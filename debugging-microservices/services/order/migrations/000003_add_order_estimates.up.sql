@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS estimated_ready_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS estimated_delivery_at TIMESTAMP;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS driver_id;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS driver_id VARCHAR(255);
\ No newline at end of file
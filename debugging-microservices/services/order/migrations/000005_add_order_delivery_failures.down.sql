@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS delivery_failure_reason,
+    DROP COLUMN IF EXISTS delivery_attempts;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS delivery_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS delivery_failure_reason VARCHAR(50);
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS proof_captured_at,
+    DROP COLUMN IF EXISTS proof_longitude,
+    DROP COLUMN IF EXISTS proof_latitude,
+    DROP COLUMN IF EXISTS proof_url,
+    DROP COLUMN IF EXISTS proof_kind,
+    DROP COLUMN IF EXISTS proof_recipient_name;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS proof_recipient_name VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS proof_kind VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS proof_url TEXT,
+    ADD COLUMN IF NOT EXISTS proof_latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS proof_longitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS proof_captured_at TIMESTAMP;
\ No newline at end of file